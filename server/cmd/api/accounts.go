@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// accountParam() returns the "id" URL parameter naming an account, and whether the
+// caller may read that account. Callers may read their own account, and admins every
+// account of their tenant.
+func (app *application) accountParam(r *http.Request) (string, bool) {
+	account := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	if !app.config.auth {
+		return account, true
+	}
+
+	p := app.contextGetPrincipal(r)
+	return account, p != nil && (account == p.Subject || data.HasScope(p.Scopes, data.ScopeAdmin))
+}
+
+// GetAccountExpirationsHandler for the 'Get /v1/accounts/:id/expirations' endpoint.
+// Reports the account's points balance and when its points are going to expire.
+func (app *application) getAccountExpirationsHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := app.accountParam(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	expirations := app.store.Ledger.Expirations(app.requestTenant(r), account)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"expirations": expirations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
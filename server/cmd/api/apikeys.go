@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"net/http"
+	"os"
+)
+
+// CreateAPIKeyHandler for the 'Post /v1/admin/keys' endpoint. The plaintext token is
+// only ever included in this response. Keys belong to the caller's tenant unless an
+// admin of the default tenant, which operates the deployment, names another one.
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Tenant string   `json:"tenant"`
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tenant := app.requestTenant(r)
+	key := &data.APIKey{
+		Tenant: data.TenantOrDefault(input.Tenant),
+		Name:   input.Name,
+		Scopes: input.Scopes,
+	}
+	if input.Tenant == "" {
+		key.Tenant = tenant
+	}
+
+	v := validator.New()
+	data.ValidateAPIKey(v, key)
+	v.Check(tenant == data.DefaultTenant || key.Tenant == tenant, "tenant", "must be your own tenant")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, hash, err := data.GenerateAPIKeyToken()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	key.Hash = hash
+	key.Prefix = token[:8]
+
+	err = app.store.APIKeys.Insert(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.auditChange(r, "key:"+key.ID.String(), nil, key)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/keys/%s", key.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"key": key, "token": token}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ListAPIKeysHandler for the 'Get /v1/admin/keys' endpoint.
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.store.APIKeys.GetAll(app.requestTenant(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ShowAPIKeyHandler for the 'Get /v1/admin/keys/:id' endpoint.
+func (app *application) showAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := app.store.APIKeys.Get(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteAPIKeyHandler for the 'Delete /v1/admin/keys/:id' endpoint. The key stops
+// authenticating immediately.
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := app.store.APIKeys.Delete(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "key:"+key.ID.String(), key, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "API key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runKeygen() implements the 'api keygen' subcommand. It mints an API key token and
+// prints it along with its hash. Starting the server with the hash as -admin-key-hash
+// registers the token as an admin key, without the plaintext ever being stored.
+func runKeygen() error {
+	token, hash, err := data.GenerateAPIKeyToken()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "key:  %s\nhash: %s\n\n", token, hash)
+	fmt.Fprintf(os.Stdout, "Start the server with -admin-key-hash %s and keep the key secret.\n", hash)
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// CreateCampaignHandler for the 'Post /v1/admin/campaigns' endpoint.
+func (app *application) createCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name       string        `json:"name"`
+		StartDate  string        `json:"startDate"`
+		EndDate    string        `json:"endDate"`
+		Weekdays   []string      `json:"weekdays"`
+		RetailerID *uuid.UUID    `json:"retailerId"`
+		Retailer   *data.Matcher `json:"retailer"`
+		Item       *data.Matcher `json:"item"`
+		Category   string        `json:"category"`
+		Bonus      data.Bonus    `json:"bonus"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	campaign := &data.Campaign{
+		Tenant:     app.requestTenant(r),
+		Name:       input.Name,
+		StartDate:  input.StartDate,
+		EndDate:    input.EndDate,
+		Weekdays:   input.Weekdays,
+		RetailerID: input.RetailerID,
+		Retailer:   input.Retailer,
+		Item:       input.Item,
+		Category:   input.Category,
+		Bonus:      input.Bonus,
+	}
+
+	v := validator.New()
+	data.ValidateCampaign(v, campaign)
+	if campaign.RetailerID != nil {
+		_, err := app.store.Retailers.Get(*campaign.RetailerID)
+		v.Check(err == nil, "retailerId", "must reference a retailer in the catalog")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Campaigns.Insert(campaign)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.auditChange(r, "campaign:"+campaign.ID.String(), nil, campaign)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/campaigns/%s", campaign.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"campaign": campaign}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ListCampaignsHandler for the 'Get /v1/admin/campaigns' endpoint.
+func (app *application) listCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := app.store.Campaigns.GetAll(app.requestTenant(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"campaigns": campaigns}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ShowCampaignHandler for the 'Get /v1/admin/campaigns/:id' endpoint.
+func (app *application) showCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	campaign, err := app.store.Campaigns.Get(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"campaign": campaign}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// UpdateCampaignHandler for the 'Patch /v1/admin/campaigns/:id' endpoint. Only the
+// fields present in the request body are changed, and a null 'retailerId', 'retailer'
+// or 'item' removes that condition.
+func (app *application) updateCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	campaign, err := app.store.Campaigns.Get(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *campaign
+
+	var input struct {
+		Name       *string                `json:"name"`
+		StartDate  *string                `json:"startDate"`
+		EndDate    *string                `json:"endDate"`
+		Weekdays   []string               `json:"weekdays"`
+		RetailerID nullable[uuid.UUID]    `json:"retailerId"`
+		Retailer   nullable[data.Matcher] `json:"retailer"`
+		Item       nullable[data.Matcher] `json:"item"`
+		Category   *string                `json:"category"`
+		Bonus      *data.Bonus            `json:"bonus"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		campaign.Name = *input.Name
+	}
+	if input.StartDate != nil {
+		campaign.StartDate = *input.StartDate
+	}
+	if input.EndDate != nil {
+		campaign.EndDate = *input.EndDate
+	}
+	if input.Weekdays != nil {
+		campaign.Weekdays = input.Weekdays
+	}
+	if input.RetailerID.Set {
+		campaign.RetailerID = input.RetailerID.Value
+	}
+	if input.Retailer.Set {
+		campaign.Retailer = input.Retailer.Value
+	}
+	if input.Item.Set {
+		campaign.Item = input.Item.Value
+	}
+	if input.Category != nil {
+		campaign.Category = *input.Category
+	}
+	if input.Bonus != nil {
+		campaign.Bonus = *input.Bonus
+	}
+
+	v := validator.New()
+	data.ValidateCampaign(v, campaign)
+	if campaign.RetailerID != nil {
+		_, err := app.store.Retailers.Get(*campaign.RetailerID)
+		v.Check(err == nil, "retailerId", "must reference a retailer in the catalog")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Campaigns.Update(campaign)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "campaign:"+campaign.ID.String(), before, campaign)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"campaign": campaign}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteCampaignHandler for the 'Delete /v1/admin/campaigns/:id' endpoint.
+func (app *application) deleteCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	campaign, err := app.store.Campaigns.Delete(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "campaign:"+campaign.ID.String(), campaign, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "campaign successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
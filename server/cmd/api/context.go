@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"net/http"
+)
+
+// contextKey type used for the keys of values the middleware stores in the request
+// context, so they can't collide with keys set by other packages.
+type contextKey string
+
+const (
+	requestContextKey   = contextKey("request")
+	principalContextKey = contextKey("principal")
+	auditContextKey     = contextKey("audit")
+)
+
+// requestInfo identifies a request in logs and error responses. Route is the pattern of
+// the route that matched the request, and is empty until the router has dispatched it.
+type requestInfo struct {
+	ID    string
+	Route string
+}
+
+// principal is the authenticated caller of a request, identified either by an API key
+// or by a JWT bearer token. APIKey is nil for callers authenticated with a JWT.
+type principal struct {
+	Subject string
+	Tenant  string
+	Scopes  []string
+	APIKey  *data.APIKey
+}
+
+// contextSetRequestInfo() returns a copy of the request with its requestInfo added to
+// its context.
+func (app *application) contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), requestContextKey, info)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestInfo() returns the requestInfo of the request, or nil outside of the
+// logRequests() middleware.
+func (app *application) contextGetRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestContextKey).(*requestInfo)
+	return info
+}
+
+// requestID() returns the id of the request, or an empty string outside of the
+// logRequests() middleware.
+func (app *application) requestID(r *http.Request) string {
+	if info := app.contextGetRequestInfo(r); info != nil {
+		return info.ID
+	}
+
+	return ""
+}
+
+// contextSetPrincipal() returns a copy of the request with the authenticated caller
+// added to its context.
+func (app *application) contextSetPrincipal(r *http.Request, p *principal) *http.Request {
+	ctx := context.WithValue(r.Context(), principalContextKey, p)
+	return r.WithContext(ctx)
+}
+
+// contextGetPrincipal() returns the authenticated caller of the request, or nil when
+// the request didn't present credentials.
+func (app *application) contextGetPrincipal(r *http.Request) *principal {
+	p, _ := r.Context().Value(principalContextKey).(*principal)
+	return p
+}
+
+// contextSetAudit() returns a copy of the request with the audit record of the request
+// added to its context.
+func (app *application) contextSetAudit(r *http.Request, c *auditRecord) *http.Request {
+	ctx := context.WithValue(r.Context(), auditContextKey, c)
+	return r.WithContext(ctx)
+}
+
+// contextGetAudit() returns the audit record of the request, or nil when the request
+// isn't audited.
+func (app *application) contextGetAudit(r *http.Request) *auditRecord {
+	c, _ := r.Context().Value(auditContextKey).(*auditRecord)
+	return c
+}
+
+// requestSubject() returns the subject receipts created by the request are attributed
+// to, or an empty string for anonymous requests.
+func (app *application) requestSubject(r *http.Request) string {
+	if p := app.contextGetPrincipal(r); p != nil {
+		return p.Subject
+	}
+
+	return ""
+}
+
+// requestTenant() returns the tenant the request acts on behalf of. Anonymous requests
+// and callers without a tenant belong to the default tenant.
+func (app *application) requestTenant(r *http.Request) string {
+	if p := app.contextGetPrincipal(r); p != nil {
+		return data.TenantOrDefault(p.Tenant)
+	}
+
+	return data.DefaultTenant
+}
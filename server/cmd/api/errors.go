@@ -2,22 +2,28 @@ package main
 
 import (
 	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/parser"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-// logError() helps with logging error messages along with the current request method and URL as attributes in the entry.
+// logError() helps with logging error messages along with the current request id, method and URL as attributes in the entry.
 func (app *application) logError(r *http.Request, err error) {
 	var (
-		method = r.Method
-		uri    = r.RequestURI
+		requestID = app.requestID(r)
+		method    = r.Method
+		uri       = r.RequestURI
 	)
-	app.logger.Error(err.Error(), "method", method, "uri", uri)
+	app.logger.Error(err.Error(), "request_id", requestID, "method", method, "uri", uri)
 }
 
 // errorResponse() helps with sending JSON-formatted error messages to the client with a
-// given status code.
+// given status code, along with the request id to quote when reporting the problem.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	jsnEnv := envelope{"error": message}
+	jsnEnv := envelope{"error": message, "requestId": app.requestID(r)}
 	err := app.writeJSON(w, status, jsnEnv, nil)
 	if err != nil {
 		app.logError(r, err)
@@ -56,7 +62,100 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 }
 
 // failedValidationResponse() method writes a 422 Unprocessable Entity and the contents of
-// the errors map from our new Validator type as a JSON response body.
+// the errors map from our new Validator type as a JSON response body. Every failing field
+// is counted in the validation failure metrics.
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	for field := range errors {
+		app.metrics.validationFailures.Inc(field)
+	}
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
+
+// failedParseResponse() method writes a 422 Unprocessable Entity like
+// failedValidationResponse() for a plain-text receipt, along with the parser's confidence
+// and the lines it couldn't parse so the client can tell why fields are missing.
+func (app *application) failedParseResponse(w http.ResponseWriter, r *http.Request, errors map[string]string, result *parser.Result) {
+	for field := range errors {
+		app.metrics.validationFailures.Inc(field)
+	}
+
+	jsnEnv := envelope{"error": errors, "parse": result, "requestId": app.requestID(r)}
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, jsnEnv, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// editConflictResponse() method writes a 409 Conflict status code and JSON response
+// when a record was modified between being read and being updated.
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// serviceUnavailableResponse() method writes a 503 Service Unavailable status code and
+// JSON response when the server can't take on more work right now.
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Retry-After", "1")
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+// invalidAPIKeyResponse() method writes a 401 Unauthorized status code and JSON
+// response when the API key presented with the request is unknown or revoked.
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+	message := "invalid or revoked API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// invalidAuthenticationTokenResponse() method writes a 401 Unauthorized status code and
+// JSON response when a bearer token is rejected, explaining why.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	message := fmt.Sprintf("invalid authentication token: %s", err)
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// authenticationRequiredResponse() method writes a 401 Unauthorized status code and
+// JSON response when a protected endpoint is requested without credentials.
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+	if app.verifier != nil {
+		w.Header().Add("WWW-Authenticate", "Bearer")
+	}
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// notPermittedResponse() method writes a 403 Forbidden status code and JSON response
+// when the credentials don't grant the scope the endpoint requires.
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your credentials don't grant the necessary scope to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// rateLimitExceededResponse() method writes a 429 Too Many Requests status code and
+// JSON response, telling the client in Retry-After when it may try again.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// quotaExceededResponse() method writes a 422 Unprocessable Entity status code and JSON
+// response naming each daily quota the receipt would exceed, along with the account's
+// quota usage so the client knows when it may submit again.
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request, err *data.QuotaExceededError) {
+	errors := make(map[string]string, len(err.Exceeded))
+	for _, quota := range err.Exceeded {
+		errors[quota] = "daily quota exceeded"
+	}
+
+	jsnEnv := envelope{"error": errors, "quota": err.Usage, "requestId": app.requestID(r)}
+	werr := app.writeJSON(w, http.StatusUnprocessableEntity, jsnEnv, nil)
+	if werr != nil {
+		app.logError(r, werr)
+		w.WriteHeader(500)
+	}
+}
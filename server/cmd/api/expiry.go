@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"log/slog"
+	"time"
+)
+
+// expiryWorker writes the expiry entries of points that are due to the ledger, once on
+// start and then every interval.
+type expiryWorker struct {
+	ledger   data.LedgerModel
+	logger   *slog.Logger
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newExpiryWorker(ledger data.LedgerModel, interval time.Duration, logger *slog.Logger) *expiryWorker {
+	return &expiryWorker{
+		ledger:   ledger,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start() launches the worker.
+func (e *expiryWorker) start() {
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			e.run(time.Now())
+
+			select {
+			case <-ticker.C:
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (e *expiryWorker) run(now time.Time) {
+	entries, points := e.ledger.Expire(now)
+	if entries > 0 {
+		e.logger.Info("points expired", "entries", entries, "points", points)
+	}
+}
+
+// shutdown() stops the worker and waits for a run in progress to finish.
+func (e *expiryWorker) shutdown(ctx context.Context) error {
+	close(e.stop)
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Number of receipts written between flushes of an export stream.
+const exportFlushInterval = 100
+
+var csvExportHeader = []string{
+	"id", "retailer", "retailerName", "purchaseDate", "purchaseTime", "total", "points",
+	"itemIndex", "itemShortDescription", "itemPrice", "itemCategory",
+}
+
+// ExportReceiptsHandler for the 'Get /v1/receipts/export' endpoint. Streams the receipts
+// matching the listing filters as CSV (one row per item, receipt columns repeated) or
+// NDJSON (one receipt per line), fetching and flushing them one at a time rather than
+// encoding the whole result set in memory.
+func (app *application) exportReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	filters := app.readReceiptFilters(qs)
+	format := app.readString(qs, "format", "csv")
+
+	v := validator.New()
+	data.ValidateReceiptFilters(v, filters)
+	v.Check(validator.PermittedValue(format, "csv", "ndjson"), "format", "must be csv or ndjson")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tenant := app.requestTenant(r)
+	ids, err := app.store.Receipts.IDs(tenant, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Large exports outlive the server's write timeout, so lift it for this response.
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var write func(receipt *data.Receipt) error
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="receipts.ndjson"`)
+		enc := json.NewEncoder(w)
+		write = func(receipt *data.Receipt) error {
+			return enc.Encode(receipt)
+		}
+	default:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="receipts.csv"`)
+		cw := csv.NewWriter(w)
+		write = func(receipt *data.Receipt) error {
+			for _, row := range csvExportRows(receipt) {
+				if err := cw.Write(row); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+		cw.Write(csvExportHeader)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	for i, id := range ids {
+		receipt, err := app.store.Receipts.Get(tenant, id)
+		if err != nil {
+			// Receipts deleted since the ids were collected are skipped.
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue
+			}
+			app.logError(r, err)
+			return
+		}
+
+		err = write(receipt)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		if (i+1)%exportFlushInterval == 0 {
+			rc.Flush()
+		}
+	}
+	rc.Flush()
+}
+
+// csvExportRows() flattens a receipt into one CSV row per item, repeating the receipt
+// columns on each row. A receipt without items produces a single row with empty item
+// columns.
+func csvExportRows(receipt *data.Receipt) [][]string {
+	base := []string{
+		receipt.ID.String(),
+		receipt.Retailer,
+		receipt.RetailerName,
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		receipt.Total.StringFixed(2),
+		strconv.Itoa(int(receipt.Points)),
+	}
+
+	if len(receipt.Items) == 0 {
+		return [][]string{append(base, "", "", "", "")}
+	}
+
+	rows := make([][]string, 0, len(receipt.Items))
+	for i, item := range receipt.Items {
+		row := append(append([]string{}, base...),
+			strconv.Itoa(i),
+			item.ShortDescription,
+			item.Price.StringFixed(2),
+			item.Category,
+		)
+		rows = append(rows, row)
+	}
+
+	return rows
+}
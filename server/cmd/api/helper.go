@@ -4,15 +4,32 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
 type envelope map[string]any
 
+// nullable is a field of a partial update's JSON body that may be left out to keep its
+// current value, or set to null to clear it. Set reports whether it was present.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	return json.Unmarshal(b, &n.Value)
+}
+
 // realIDParam() retrieves the "id" URL parameter from the current request content, then
 // convert it to an uuid and return it. If the operation is unsuccessful,
 // return uuid.Nil and error.
@@ -26,6 +43,19 @@ func (app *application) realIDParam(r *http.Request) (uuid.UUID, error) {
 	return id, nil
 }
 
+// itemIndexParam() retrieves the "index" URL parameter from the current request content,
+// then convert it to a non-negative integer and return it. If the operation is
+// unsuccessful, return -1 and error.
+func (app *application) itemIndexParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	index, err := strconv.Atoi(params.ByName("index"))
+	if err != nil || index < 0 {
+		return -1, errors.New("invalid index parameter")
+	}
+
+	return index, nil
+}
+
 // writeJSON() takes the destination http.ResponseWriter, the HTTP status code to send,
 // the data to encode to JSON, and a header map containing any other HTTP header.
 func (app *application) writeJSON(w http.ResponseWriter, status int, jsnData envelope, headers http.Header) error {
@@ -45,6 +75,27 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, jsnData env
 	return nil
 }
 
+// readText() reads a plain-text request body, limited to the same size as JSON bodies.
+func (app *application) readText(w http.ResponseWriter, r *http.Request) (string, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return "", fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		return "", err
+	}
+
+	if strings.TrimSpace(string(body)) == "" {
+		return "", errors.New("body must not be empty")
+	}
+
+	return string(body), nil
+}
+
 // readJSON() takes the destination http.ResponseWriter, the *http.Request, and a target
 // destination to decode the JSON from the request body as normal, then triage the errors and
 // replace them with our own custom messages as necessary.
@@ -91,3 +142,72 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// readString() returns a string value from the query string, or the provided default
+// value if no matching key could be found.
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// readInt() reads a string value from the query string and converts it to an integer
+// before returning. If no matching key could be found it returns the provided default
+// value. If the value couldn't be converted to an integer, then we record an error
+// message in the provided Validator instance.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readReceiptFilters() reads the receipt listing filters shared by the list and export
+// endpoints from the query string.
+func (app *application) readReceiptFilters(qs url.Values) data.ReceiptFilters {
+	// 'held=true' filtered receipts held for review before receipts had a status, and
+	// is kept as an alias of 'status=pending'.
+	status := app.readString(qs, "status", "")
+	if status == "" && app.readBool(qs, "held") {
+		status = data.StatusPending
+	}
+
+	return data.ReceiptFilters{
+		Retailer: app.readString(qs, "retailer", ""),
+		From:     app.readString(qs, "from", ""),
+		To:       app.readString(qs, "to", ""),
+		Status:   status,
+	}
+}
+
+// clientIP() returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// readBool() reports whether the query string value for the key is a true boolean
+// ("true", "1", "t", ...). Missing or unparsable values are false.
+func (app *application) readBool(qs url.Values, key string) bool {
+	b, err := strconv.ParseBool(qs.Get(key))
+	if err != nil {
+		return false
+	}
+
+	return b
+}
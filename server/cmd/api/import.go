@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/importer"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum number of rejected records echoed back in an import response. The summary
+// still counts every rejected record.
+const maxImportRejects = 1000
+
+// ImportReceiptsHandler for the 'Post /v1/admin/import' endpoint. Streams NDJSON or CSV
+// receipts from the request body into the store. Accepts 'format' (ndjson or csv) and
+// 'offset' to resume a previous import after the given line.
+func (app *application) importReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	format := app.readString(qs, "format", importer.FormatNDJSON)
+	offset := app.readInt(qs, "offset", 0, v)
+
+	v.Check(validator.PermittedValue(format, importer.FormatNDJSON, importer.FormatCSV), "format", "must be ndjson or csv")
+	v.Check(offset >= 0, "offset", "must not be negative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Import bodies can be far larger and slower than a single receipt, so lift the
+	// server's read and write deadlines for this request.
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rejects := []importer.Reject{}
+	opts := importer.Options{
+		Format: format,
+		Offset: offset,
+		OnReject: func(reject importer.Reject) error {
+			if len(rejects) < maxImportRejects {
+				rejects = append(rejects, reject)
+			}
+			return nil
+		},
+		Progress: func(summary importer.Summary) {
+			app.logger.Info("import progress", "line", summary.Line, "inserted", summary.Inserted, "rejected", summary.Rejected)
+		},
+	}
+
+	dst := tenantInserter{store: app.store.Receipts, tenant: app.requestTenant(r)}
+	summary, err := importer.Run(r.Body, dst, opts)
+	app.auditChange(r, "receipts", nil, summary)
+
+	jsnEnv := envelope{"import": summary, "rejects": rejects}
+	status := http.StatusOK
+	if err != nil {
+		app.logError(r, err)
+		jsnEnv["error"] = err.Error()
+		status = http.StatusBadRequest
+	}
+
+	err = app.writeJSON(w, status, jsnEnv, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// tenantInserter inserts imported receipts into the store on behalf of a tenant.
+type tenantInserter struct {
+	store  data.ReceiptStore
+	tenant string
+}
+
+func (ti tenantInserter) Insert(receipt *data.Receipt) error {
+	receipt.Tenant = ti.tenant
+	return ti.store.Insert(receipt)
+}
+
+// importResponse is the body of a 'Post /v1/admin/import' response.
+type importResponse struct {
+	Import  importer.Summary  `json:"import"`
+	Rejects []importer.Reject `json:"rejects"`
+	Error   any               `json:"error"`
+}
+
+// remoteImport() streams the file to a running server's 'Post /v1/admin/import'
+// endpoint, starting after the offset line, and decodes the server's summary. The
+// request has no timeout, as the server lifts its deadlines for imports.
+func remoteImport(client *http.Client, baseURL, apiKey, format string, offset int, src io.Reader) (*importResponse, error) {
+	qs := url.Values{}
+	qs.Set("format", format)
+	qs.Set("offset", strconv.Itoa(offset))
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/admin/import?"+qs.Encode(), src)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if format == importer.FormatCSV {
+		req.Header.Set("Content-Type", "text/csv")
+	}
+	req.Header.Set("X-API-Key", apiKey)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var resp importResponse
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	if err != nil {
+		return nil, fmt.Errorf("server responded with %s: %w", res.Status, err)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return &resp, nil
+	case res.StatusCode == http.StatusBadRequest && resp.Error != nil:
+		// The import ran and stopped early, so the summary says where to resume.
+		return &resp, fmt.Errorf("%v", resp.Error)
+	default:
+		return nil, fmt.Errorf("server responded with %s: %v", res.Status, resp.Error)
+	}
+}
+
+// runImport() implements the 'api import' subcommand. It streams an NDJSON or CSV file
+// to a running server's 'Post /v1/admin/import' endpoint, which validates and inserts
+// the receipts as a single request, and writes the rejected records the server returns
+// to a rejects file. When the import stops early, the line to pass as -offset to resume
+// is taken from the server's summary and logged.
+func runImport(args []string, lgr *slog.Logger) error {
+	var (
+		file    string
+		format  string
+		offset  int
+		rejects string
+		addr    string
+		apiKey  string
+	)
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.StringVar(&file, "file", "", "NDJSON or CSV file of receipts to import")
+	fs.StringVar(&format, "format", "", "Input format (ndjson|csv), detected from the file extension by default")
+	fs.IntVar(&offset, "offset", 0, "Resume after this line of the input file")
+	fs.StringVar(&rejects, "rejects", "", "Rejects file (defaults to <file>.rejects.ndjson)")
+	fs.StringVar(&addr, "addr", "http://localhost:8080", "Base URL of the running API server")
+	fs.StringVar(&apiKey, "key", os.Getenv("RECEIPTS_API_KEY"), "API key with the admin scope (defaults to $RECEIPTS_API_KEY)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if file == "" {
+		return errors.New("import: -file must be provided")
+	}
+	if format == "" {
+		format = importer.FormatNDJSON
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			format = importer.FormatCSV
+		}
+	}
+	if rejects == "" {
+		rejects = file + ".rejects.ndjson"
+	}
+
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// A resumed import appends to the rejects of the earlier attempt.
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	rejectsFile, err := os.OpenFile(rejects, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer rejectsFile.Close()
+	enc := json.NewEncoder(rejectsFile)
+
+	baseURL := strings.TrimSuffix(addr, "/")
+	lgr.Info("importing receipts", "file", file, "addr", baseURL, "offset", offset)
+
+	resp, err := remoteImport(&http.Client{}, baseURL, apiKey, format, offset, src)
+	if resp == nil {
+		return fmt.Errorf("import failed before the server returned a summary, its log has the last progress: %w", err)
+	}
+
+	// Rejects are written even when the import stopped early, so that a resumed import
+	// appends to a complete set.
+	for _, reject := range resp.Rejects {
+		if encErr := enc.Encode(reject); encErr != nil {
+			return encErr
+		}
+	}
+	summary := resp.Import
+	if summary.Rejected > len(resp.Rejects) {
+		lgr.Warn("the server returned only some of the rejected records", "rejected", summary.Rejected, "returned", len(resp.Rejects))
+	}
+
+	if err != nil {
+		return fmt.Errorf("import stopped after %d inserted and %d rejected, resume with -offset %d: %w", summary.Inserted, summary.Rejected, summary.Line, err)
+	}
+
+	lgr.Info("import complete", "lines", summary.Line, "inserted", summary.Inserted, "rejected", summary.Rejected, "skipped", summary.Skipped, "rejects", rejects)
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+
+	// How long finished jobs are kept for status lookups.
+	jobRetention = time.Hour
+)
+
+var (
+	errQueueFull   = errors.New("job queue is full")
+	errQueueClosed = errors.New("job queue is shut down")
+)
+
+// job tracks the asynchronous processing of a single receipt.
+type job struct {
+	ID        uuid.UUID  `json:"id"`
+	Status    string     `json:"status"`
+	ReceiptID *uuid.UUID `json:"receiptId,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	tenant    string
+	receipt   *data.Receipt
+	// audit is the audit entry of the request that queued the job, completed once the
+	// receipt is processed.
+	audit data.AuditEntry
+}
+
+// jobQueue is a bounded queue of receipts processed by a fixed pool of workers.
+type jobQueue struct {
+	queue   chan *job
+	jobs    map[uuid.UUID]*job
+	mu      sync.RWMutex
+	wg      sync.WaitGroup
+	closed  bool
+	workers int
+	logger  *slog.Logger
+	process func(*job) error
+}
+
+func newJobQueue(workers, size int, logger *slog.Logger, process func(*job) error) *jobQueue {
+	return &jobQueue{
+		queue:   make(chan *job, size),
+		jobs:    make(map[uuid.UUID]*job),
+		workers: workers,
+		logger:  logger,
+		process: process,
+	}
+}
+
+// start() launches the worker pool.
+func (q *jobQueue) start() {
+	for range q.workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+func (q *jobQueue) work() {
+	defer q.wg.Done()
+
+	for j := range q.queue {
+		q.mu.Lock()
+		j.Status = jobRunning
+		j.UpdatedAt = time.Now()
+		q.mu.Unlock()
+
+		err := q.run(j)
+		q.finish(j, err)
+	}
+}
+
+// run() processes a job's receipt, turning a panic into a failed job rather than
+// taking down the worker.
+func (q *jobQueue) run(j *job) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%s", rec)
+		}
+	}()
+
+	return q.process(j)
+}
+
+// finish() records the outcome of a job and releases its receipt.
+func (q *jobQueue) finish(j *job, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j.UpdatedAt = time.Now()
+	if err != nil {
+		j.Status = jobFailed
+		j.Error = err.Error()
+		q.logger.Error(err.Error(), "job", j.ID.String())
+	} else {
+		j.Status = jobSucceeded
+		j.ReceiptID = &j.receipt.ID
+	}
+	j.receipt = nil
+}
+
+// enqueue() queues a receipt for processing without blocking, along with the audit entry
+// of the request that queued it. It fails with errQueueFull when the queue is at
+// capacity and errQueueClosed once the queue is shut down.
+func (q *jobQueue) enqueue(receipt *data.Receipt, audit data.AuditEntry) (job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return job{}, errQueueClosed
+	}
+	q.prune()
+
+	now := time.Now()
+	j := &job{
+		ID:        uuid.New(),
+		Status:    jobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		tenant:    receipt.Tenant,
+		receipt:   receipt,
+		audit:     audit,
+	}
+
+	select {
+	case q.queue <- j:
+		q.jobs[j.ID] = j
+		return *j, nil
+	default:
+		return job{}, errQueueFull
+	}
+}
+
+// prune() forgets finished jobs older than jobRetention. The caller must hold the lock.
+func (q *jobQueue) prune() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, j := range q.jobs {
+		if (j.Status == jobSucceeded || j.Status == jobFailed) && j.UpdatedAt.Before(cutoff) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// get() returns a snapshot of the job with the given id.
+func (q *jobQueue) get(tenant string, id uuid.UUID) (job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	j, exists := q.jobs[id]
+	if !exists || j.tenant != tenant {
+		return job{}, false
+	}
+
+	return *j, true
+}
+
+// shutdown() stops accepting jobs and waits for the workers to drain the queue, or for
+// the context to be done.
+func (q *jobQueue) shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueueReceipt() queues a validated receipt for asynchronous processing and writes a
+// 202 Accepted response containing the job, merged with any extra envelope fields.
+func (app *application) enqueueReceipt(w http.ResponseWriter, r *http.Request, receipt *data.Receipt, extra envelope) {
+	j, err := app.jobs.enqueue(receipt, app.auditEntry(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, errQueueFull):
+			app.serviceUnavailableResponse(w, r, "the receipt processing queue is full, please try again later")
+		case errors.Is(err, errQueueClosed):
+			app.serviceUnavailableResponse(w, r, "the server is shutting down, please try again later")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "job:"+j.ID.String(), nil, j)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/jobs/%s", j.ID))
+
+	jsnEnv := envelope{"job": j}
+	for key, value := range extra {
+		jsnEnv[key] = value
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, jsnEnv, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// processJob() inserts a queued receipt and appends an audit entry for it, attributed to
+// the actor and request that queued it, as for a receipt inserted synchronously.
+func (app *application) processJob(j *job) error {
+	err := app.store.Receipts.Insert(j.receipt)
+
+	entry := j.audit
+	entry.At = time.Now()
+	var quotaErr *data.QuotaExceededError
+	switch {
+	case err == nil:
+		entry.Status = http.StatusCreated
+		entry.Resource = "receipt:" + j.receipt.ID.String()
+		entry.After = data.AuditHash(j.receipt)
+	case errors.As(err, &quotaErr):
+		entry.Status = http.StatusUnprocessableEntity
+		entry.Resource = "job:" + j.ID.String()
+	default:
+		entry.Status = http.StatusInternalServerError
+		entry.Resource = "job:" + j.ID.String()
+	}
+
+	if aerr := app.audit.Append(&entry); aerr != nil {
+		app.logger.Error(aerr.Error(), "job", j.ID.String())
+	}
+
+	return err
+}
+
+// GetJobHandler for the 'Get /v1/jobs/:id' endpoint.
+func (app *application) getJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	j, exists := app.jobs.get(app.requestTenant(r), id)
+	if !exists {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"job": j}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// GetLeaderboardHandler for the 'Get /v1/leaderboards/:kind' endpoint, where kind is
+// retailer or account. Accepts an
+// optional 'window' (day, week, month, year or all), 'limit', and 'entity' to look up
+// the rank of a specific entity. Like stats, leaderboards are eventually consistent and
+// may not reflect a receipt until shortly after it was stored.
+func (app *application) getLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+
+	v := validator.New()
+	qs := r.URL.Query()
+	window := app.readString(qs, "window", "month")
+	limit := app.readInt(qs, "limit", 10, v)
+	entity := app.readString(qs, "entity", "")
+
+	if data.ValidateLeaderboardQuery(v, kind, window, limit); !v.Valid() {
+		if _, exists := v.Errors["kind"]; exists {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, ranked, err := app.store.Leaderboards.Get(app.requestTenant(r), kind, window, limit, entity)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	jsnEnv := envelope{"kind": kind, "window": window, "leaderboard": entries}
+	if entity != "" {
+		jsnEnv["entity"] = ranked
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsnEnv, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
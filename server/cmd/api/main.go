@@ -2,10 +2,11 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/jwt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/parser"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
 	"log/slog"
-	"net/http"
 	"os"
 	"time"
 )
@@ -14,22 +15,106 @@ import (
 const version = "1.0.0"
 
 // Config struct holding all the configuration settings for the
-// application (network port, current operating environment
-// (development, staging, production, etc.)).
+// application.
 type config struct {
+	// Network port and current operating environment (development, staging,
+	// production, etc.).
 	port int
 	env  string
+	// Item category rules, loyalty tier rules and plain-text receipt layout files.
+	categories string
+	tiers      string
+	layouts    string
+	// Worker pool and queue size for asynchronous receipt processing.
+	workers   int
+	queueSize int
+	// Receipt event log and audit log files.
+	eventLog string
+	auditLog string
+	// Per-tenant configuration file.
+	tenants string
+	// API key authentication.
+	auth         bool
+	adminKeyHash string
+	// Rate limits per client, per IP address and per route.
+	limiter struct {
+		enabled bool
+		rps     float64
+		burst   int
+		ipRPS   float64
+		ipBurst int
+		routes  []routeLimit
+	}
+	// Per-account daily quotas and what happens to receipts over them.
+	quota struct {
+		mode   string
+		limits data.QuotaLimits
+	}
+	// Fraud risk score at which receipts are held for review.
+	riskThreshold int
+	// Points expiration policy and how often expired points are written off.
+	expiration struct {
+		policy   data.ExpirationPolicy
+		interval time.Duration
+	}
+	// JWT bearer token verification keys and expected claims.
+	jwt struct {
+		secret    string
+		publicKey string
+		jwks      string
+		issuer    string
+		audience  string
+	}
 }
 
 // Application struct holding the dependencies for the HTTP
 // handlers, helpers, and middleware.
 type application struct {
-	config config
-	logger *slog.Logger
-	store  data.Stores
+	config   config
+	logger   *slog.Logger
+	store    data.Stores
+	parser   *parser.Parser
+	jobs     *jobQueue
+	webhooks *webhookDispatcher
+	expiry   *expiryWorker
+	stream   *receiptBroker
+	verifier *jwt.Verifier
+	limiter  *rateLimiter
+	audit    *data.AuditLog
+	metrics  *appMetrics
 }
 
 func main() {
+	// The 'import' subcommand loads receipts into an already running server
+	// instead of starting one.
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		lgr := slog.New(slog.NewTextHandler(os.Stdout, nil))
+		if err := runImport(os.Args[2:], lgr); err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	// The 'rebuild' subcommand asks a running server to rebuild its receipt
+	// projection from the event log.
+	if len(os.Args) > 1 && os.Args[1] == "rebuild" {
+		lgr := slog.New(slog.NewTextHandler(os.Stdout, nil))
+		if err := runRebuild(os.Args[2:], lgr); err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The 'keygen' subcommand mints the first admin API key.
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		if err := runKeygen(); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Instance of the config struct.
 	var cfg config
 
@@ -38,36 +123,280 @@ func main() {
 	// environment if no corresponding flags are provided.
 	flag.IntVar(&cfg.port, "port", 8080, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.categories, "categories", "", "Item category rules JSON file (defaults to the built-in dictionary)")
+	flag.StringVar(&cfg.tiers, "tiers", "", "Loyalty tier rules JSON file (defaults to the built-in bronze, silver and gold tiers)")
+	flag.StringVar(&cfg.layouts, "layouts", "", "Plain-text receipt layouts JSON file (defaults to the generic layout only)")
+	flag.IntVar(&cfg.workers, "workers", 4, "Number of async receipt processing workers")
+	flag.IntVar(&cfg.queueSize, "queue-size", 100, "Maximum number of queued async receipt processing jobs")
+	flag.StringVar(&cfg.eventLog, "event-log", "", "Receipt event log file (receipts are kept in memory only when not set)")
+	flag.StringVar(&cfg.auditLog, "audit-log", "", "Audit log file (the audit log is kept in memory only when not set)")
+	flag.StringVar(&cfg.tenants, "tenants", "", "Tenants JSON file with per-tenant category rules")
+	flag.BoolVar(&cfg.auth, "auth", true, "Require API keys (disable for local development only)")
+	flag.StringVar(&cfg.adminKeyHash, "admin-key-hash", "", "SHA-256 hash of an admin API key minted with 'api keygen'")
+	flag.StringVar(&cfg.jwt.secret, "jwt-secret", os.Getenv("JWT_SECRET"), "HS256 secret for JWT bearer tokens (defaults to $JWT_SECRET)")
+	flag.StringVar(&cfg.jwt.publicKey, "jwt-public-key", "", "PEM file with the RSA or P-256 public key for RS256/ES256 JWT bearer tokens")
+	flag.StringVar(&cfg.jwt.jwks, "jwt-jwks", "", "JWKS file with the keys for JWT bearer tokens")
+	flag.StringVar(&cfg.jwt.issuer, "jwt-issuer", "", "Required 'iss' claim of JWT bearer tokens")
+	flag.StringVar(&cfg.jwt.audience, "jwt-audience", "", "Required 'aud' claim of JWT bearer tokens")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiting")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 20, "Rate limiter maximum requests per second per client")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 40, "Rate limiter maximum burst per client")
+	flag.Float64Var(&cfg.limiter.ipRPS, "limiter-ip-rps", 100, "Rate limiter maximum requests per second per IP address, counted before authentication")
+	flag.IntVar(&cfg.limiter.ipBurst, "limiter-ip-burst", 200, "Rate limiter maximum burst per IP address, counted before authentication")
+	flag.Func("limiter-route", "Rate limit for matching requests as 'METHOD /path/prefix=rps:burst' (repeatable, defaults to 'POST /v1/receipts/process=5:10')", func(s string) error {
+		rl, err := parseRouteLimit(s)
+		if err != nil {
+			return err
+		}
+		cfg.limiter.routes = append(cfg.limiter.routes, rl)
+		return nil
+	})
+	flag.StringVar(&cfg.quota.mode, "quota-mode", data.QuotaModeReject, "What to do with receipts over an account's daily quota (reject|flag)")
+	flag.Int64Var(&cfg.quota.limits.ReceiptsPerDay, "quota-receipts", 0, "Maximum receipts per account per day (0 for no limit)")
+	flag.Int64Var(&cfg.quota.limits.RetailerReceiptsPerDay, "quota-retailer-receipts", 0, "Maximum receipts per account and retailer per day (0 for no limit)")
+	flag.Int64Var(&cfg.quota.limits.PointsPerDay, "quota-points", 0, "Maximum points per account per day (0 for no limit)")
+	flag.IntVar(&cfg.riskThreshold, "risk-threshold", data.DefaultRiskThreshold, "Fraud risk score (0-100) at which receipts are held for review")
+	flag.StringVar(&cfg.expiration.policy.Type, "expiration", data.ExpirationNone, "Points expiration policy (none|inactivity|schedule)")
+	flag.IntVar(&cfg.expiration.policy.Months, "expiration-months", 12, "Months of inactivity, or full months after the month they were earned in, before points expire")
+	flag.DurationVar(&cfg.expiration.interval, "expiration-interval", time.Hour, "How often points due to expire are written off")
+
 	flag.Parse()
 
+	if cfg.limiter.routes == nil {
+		rl, _ := parseRouteLimit("POST /v1/receipts/process=5:10")
+		cfg.limiter.routes = []routeLimit{rl}
+	}
+
 	// Structured logger that writes log entries to the standard out stream.
 	lgr := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	str := data.NewStores()
+	if cfg.limiter.rps <= 0 || cfg.limiter.burst < 1 {
+		lgr.Error("-limiter-rps and -limiter-burst must be positive")
+		os.Exit(1)
+	}
+	if cfg.limiter.ipRPS <= 0 || cfg.limiter.ipBurst < 1 {
+		lgr.Error("-limiter-ip-rps and -limiter-ip-burst must be positive")
+		os.Exit(1)
+	}
+	if cfg.quota.mode != data.QuotaModeReject && cfg.quota.mode != data.QuotaModeFlag {
+		lgr.Error("-quota-mode must be reject or flag")
+		os.Exit(1)
+	}
+	if cfg.quota.limits.ReceiptsPerDay < 0 || cfg.quota.limits.RetailerReceiptsPerDay < 0 || cfg.quota.limits.PointsPerDay < 0 {
+		lgr.Error("-quota-receipts, -quota-retailer-receipts and -quota-points must not be negative")
+		os.Exit(1)
+	}
+	v := validator.New()
+	if data.ValidateExpirationPolicy(v, cfg.expiration.policy); !v.Valid() || cfg.expiration.interval <= 0 {
+		lgr.Error("-expiration must be none, inactivity or schedule, with -expiration-months between 1 and 120 and a positive -expiration-interval")
+		os.Exit(1)
+	}
+
+	// Item categorizer built from the category rules file, or the built-in
+	// dictionary when no file is provided.
+	rules := data.DefaultCategoryRules()
+	if cfg.categories != "" {
+		var err error
+		rules, err = data.LoadCategoryRules(cfg.categories)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	categorizer, err := data.NewCategorizer(rules)
+	if err != nil {
+		lgr.Error(err.Error())
+		os.Exit(1)
+	}
+	categorizers := data.Categorizers{Default: categorizer, Tenants: make(map[string]*data.Categorizer)}
+	quotas := data.Quotas{Mode: cfg.quota.mode, Default: cfg.quota.limits, Tenants: make(map[string]data.QuotaLimits)}
+	expiration := data.ExpirationPolicies{Default: cfg.expiration.policy, Tenants: make(map[string]data.ExpirationPolicy)}
+
+	// Loyalty tiers from the tier rules file, or the built-in tiers when no file is
+	// provided.
+	tiers := data.Tiers{Default: data.DefaultTiers(), Tenants: make(map[string][]data.Tier)}
+	if cfg.tiers != "" {
+		tiers.Default, err = data.LoadTiers(cfg.tiers)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Tenants listed in the tenants file with their own category rules get their
+	// own categorizer, and those with their own tiers, quotas or expiration policy get
+	// those. Every other tenant uses the defaults.
+	if cfg.tenants != "" {
+		tenants, err := data.LoadTenants(cfg.tenants)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		for name, tenant := range tenants {
+			if tenant.Quotas != nil {
+				quotas.Tenants[name] = *tenant.Quotas
+			}
+			if tenant.Expiration != nil {
+				expiration.Tenants[name] = *tenant.Expiration
+			}
+			if tenant.Tiers != "" {
+				tiers.Tenants[name], err = data.LoadTiers(tenant.Tiers)
+				if err != nil {
+					lgr.Error(err.Error(), "tenant", name)
+					os.Exit(1)
+				}
+			}
+			if tenant.Categories == "" {
+				continue
+			}
+			rules, err := data.LoadCategoryRules(tenant.Categories)
+			if err != nil {
+				lgr.Error(err.Error(), "tenant", name)
+				os.Exit(1)
+			}
+			categorizers.Tenants[name], err = data.NewCategorizer(rules)
+			if err != nil {
+				lgr.Error(err.Error(), "tenant", name)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Receipts are event-sourced from the event log file when one is provided, and
+	// the log is replayed before the server starts.
+	var eventLog *data.EventLog
+	if cfg.eventLog != "" {
+		eventLog, err = data.OpenEventLog(cfg.eventLog)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		defer eventLog.Close()
+		if eventLog.Truncated() > 0 {
+			lgr.Warn("truncated torn event at the end of the event log", "path", cfg.eventLog, "bytes", eventLog.Truncated())
+		}
+	}
+	str, err := data.NewStores(categorizers, quotas, expiration, tiers, cfg.riskThreshold, eventLog)
+	if err != nil {
+		lgr.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Mutating requests are recorded in the audit log file when one is provided. A
+	// broken hash chain means the file was tampered with, which is reported but doesn't
+	// stop the server from recording new entries.
+	audit := data.NewAuditLog()
+	if cfg.auditLog != "" {
+		audit, err = data.OpenAuditLog(cfg.auditLog)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		defer audit.Close()
+		if audit.Truncated() > 0 {
+			lgr.Warn("truncated torn entry at the end of the audit log", "path", cfg.auditLog, "bytes", audit.Truncated())
+		}
+
+		if chain := audit.Verify(); !chain.Valid {
+			lgr.Error("audit log hash chain is broken", "file", cfg.auditLog, "entry", chain.BrokenAt)
+		}
+	}
+
+	// JWT bearer tokens are accepted once at least one verification key is
+	// configured.
+	var jwtKeys []jwt.Key
+	if cfg.jwt.secret != "" {
+		jwtKeys = append(jwtKeys, jwt.NewHMACKey("", []byte(cfg.jwt.secret)))
+	}
+	if cfg.jwt.publicKey != "" {
+		key, err := jwt.LoadPublicKeyPEM(cfg.jwt.publicKey)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		jwtKeys = append(jwtKeys, key)
+	}
+	if cfg.jwt.jwks != "" {
+		keys, err := jwt.LoadJWKS(cfg.jwt.jwks)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+		jwtKeys = append(jwtKeys, keys...)
+	}
+	var verifier *jwt.Verifier
+	if len(jwtKeys) > 0 {
+		verifier = jwt.NewVerifier(jwtKeys, cfg.jwt.issuer, cfg.jwt.audience)
+	}
+
+	// The admin key minted with 'api keygen' is registered by its hash, and is
+	// used to create every other key through the API.
+	if cfg.adminKeyHash != "" {
+		v := validator.New()
+		if data.ValidateAPIKeyHash(v, cfg.adminKeyHash); !v.Valid() {
+			lgr.Error("invalid -admin-key-hash", "error", v.Errors["hash"])
+			os.Exit(1)
+		}
+		err = str.APIKeys.Insert(&data.APIKey{Tenant: data.DefaultTenant, Name: "admin", Hash: cfg.adminKeyHash, Scopes: []string{data.ScopeAdmin}})
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+	} else if cfg.auth && len(jwtKeys) == 0 {
+		lgr.Warn("authentication is enabled but no admin key is configured, mint one with 'api keygen'")
+	}
+
+	// Plain-text receipt parser using the per-retailer layouts file, if any,
+	// on top of the generic layout.
+	var layouts []parser.Layout
+	if cfg.layouts != "" {
+		layouts, err = parser.LoadLayouts(cfg.layouts)
+		if err != nil {
+			lgr.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	prs, err := parser.New(layouts)
+	if err != nil {
+		lgr.Error(err.Error())
+		os.Exit(1)
+	}
 
 	// Instance of the application struct, containing the config struct and
 	// the logger.
 	app := &application{
-		config: cfg,
-		logger: lgr,
-		store:  str,
-	}
-
-	// HTTP server that listens on the port provided in the config struct,
-	// uses the serverMux as the handler, timeout settings (idle, read and write)
-	// and writes any log messages to the structured logger at Error level.
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		ErrorLog:     slog.NewLogLogger(lgr.Handler(), slog.LevelError),
-	}
-
-	// Start HTTP serer.
-	lgr.Info("starting server", "addr", srv.Addr, "env", cfg.env)
-	err := srv.ListenAndServe()
-	lgr.Error(err.Error())
-	os.Exit(1)
+		config:   cfg,
+		logger:   lgr,
+		store:    str,
+		parser:   prs,
+		verifier: verifier,
+		audit:    audit,
+		metrics:  newAppMetrics(str.Receipts),
+		limiter:  newRateLimiter(rateLimit{rps: cfg.limiter.rps, burst: cfg.limiter.burst}, cfg.limiter.routes),
+	}
+	app.jobs = newJobQueue(cfg.workers, cfg.queueSize, app.logger, app.processJob)
+	app.webhooks = newWebhookDispatcher(app.store.Webhooks, app.logger)
+	app.expiry = newExpiryWorker(app.store.Ledger, cfg.expiration.interval, app.logger)
+	app.stream = newReceiptBroker()
+
+	// Webhooks, the event stream and the receipt metrics react to receipt changes
+	// through the store's event bus. Subscriber failures are logged and never reach the publisher.
+	app.store.Events.OnError(func(subscriber string, event data.Event, err error) {
+		lgr.Error(err.Error(), "subscriber", subscriber, "event", event.Name())
+	})
+	app.store.Events.Subscribe("webhooks", app.webhooks.handle)
+	app.store.Events.Subscribe("stream", app.stream.handle)
+	app.store.Events.Subscribe("metrics", app.metrics.handle)
+
+	// Start the HTTP server, the receipt processing workers, the webhook
+	// delivery workers, the points expiry worker and the rate limiter cleanup.
+	go app.limiter.cleanup()
+	app.jobs.start()
+	app.webhooks.start()
+	app.expiry.start()
+	err = app.serve()
+	if err != nil {
+		lgr.Error(err.Error())
+		os.Exit(1)
+	}
 }
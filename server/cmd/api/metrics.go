@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/metrics"
+	"net/http"
+	"runtime"
+	"sync"
+)
+
+// Buckets of the points awarded per receipt.
+var pointsBuckets = []float64{0, 10, 25, 50, 75, 100, 150, 200, 300, 500}
+
+// appMetrics holds the metrics served on GET /metrics.
+type appMetrics struct {
+	registry           *metrics.Registry
+	requests           *metrics.CounterVec
+	requestDuration    *metrics.HistogramVec
+	receiptsProcessed  *metrics.CounterVec
+	validationFailures *metrics.CounterVec
+	pointsAwarded      *metrics.HistogramVec
+
+	// The Go runtime's memory statistics, read once per scrape since reading them
+	// stops the world.
+	memMu    sync.Mutex
+	memStats runtime.MemStats
+}
+
+// newAppMetrics() registers the request, receipt and Go runtime metrics. The number of
+// stored receipts and the Go runtime's statistics are read whenever the metrics are
+// scraped.
+func newAppMetrics(receipts data.ReceiptStore) *appMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry:           reg,
+		requests:           reg.NewCounterVec("http_requests_total", "HTTP requests served, by method, route and status.", "method", "route", "status"),
+		requestDuration:    reg.NewHistogramVec("http_request_duration_seconds", "HTTP request latency in seconds, by method, route and status.", metrics.DefaultBuckets, "method", "route", "status"),
+		receiptsProcessed:  reg.NewCounterVec("receipts_processed_total", "Receipts processed and stored, by the status they were stored with.", "status"),
+		validationFailures: reg.NewCounterVec("receipt_validation_failures_total", "Request validation failures, by field.", "field"),
+		pointsAwarded:      reg.NewHistogramVec("receipt_points_awarded", "Points awarded per receipt, counted once the receipt is approved.", pointsBuckets),
+	}
+	reg.NewGaugeFunc("receipts_stored", "Receipts currently stored across all tenants.", func() float64 {
+		return float64(receipts.Len())
+	})
+
+	reg.OnCollect(func() {
+		m.memMu.Lock()
+		defer m.memMu.Unlock()
+		runtime.ReadMemStats(&m.memStats)
+	})
+	memStats := func(read func(*runtime.MemStats) float64) func() float64 {
+		return func() float64 {
+			m.memMu.Lock()
+			defer m.memMu.Unlock()
+			return read(&m.memStats)
+		}
+	}
+	reg.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	reg.NewGaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", memStats(func(ms *runtime.MemStats) float64 {
+		return float64(ms.HeapAlloc)
+	}))
+	reg.NewGaugeFunc("go_memstats_heap_objects", "Number of allocated heap objects.", memStats(func(ms *runtime.MemStats) float64 {
+		return float64(ms.HeapObjects)
+	}))
+	reg.NewGaugeFunc("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", memStats(func(ms *runtime.MemStats) float64 {
+		return float64(ms.Sys)
+	}))
+	reg.NewCounterFunc("go_gc_cycles_total", "Completed GC cycles.", memStats(func(ms *runtime.MemStats) float64 {
+		return float64(ms.NumGC)
+	}))
+	reg.NewCounterFunc("go_gc_pause_seconds_total", "Total time the program was stopped for GC, in seconds.", memStats(func(ms *runtime.MemStats) float64 {
+		return float64(ms.PauseTotalNs) / 1e9
+	}))
+
+	return m
+}
+
+// handle() counts receipts as they are stored and observes the points awarded to each
+// receipt once it is approved, whether on creation or after review.
+func (m *appMetrics) handle(event data.Event) error {
+	switch e := event.(type) {
+	case data.ReceiptCreated:
+		m.receiptsProcessed.Inc(e.Receipt.Status)
+		if e.Receipt.Status == data.StatusApproved {
+			m.pointsAwarded.Observe(float64(e.Receipt.Points))
+		}
+	case data.ReceiptUpdated:
+		if e.Before.Status == data.StatusPending && e.After.Status == data.StatusApproved {
+			m.pointsAwarded.Observe(float64(e.After.Points))
+		}
+	}
+
+	return nil
+}
+
+// metricsHandler for the 'GET /metrics' endpoint. Metrics are served in the Prometheus
+// text format. They cover every tenant, so scrapers need an admin API key or token of
+// the default tenant.
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	_, err := app.metrics.registry.WriteTo(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/metrics"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestAPIKey() stores an API key of the tenant with the given scopes and returns its
+// token.
+func newTestAPIKey(t *testing.T, store data.APIKeyModel, tenant string, scopes ...string) string {
+	t.Helper()
+
+	token, hash, err := data.GenerateAPIKeyToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Insert(&data.APIKey{Tenant: tenant, Name: "test", Hash: hash, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestMetricsScrape(t *testing.T) {
+	categorizer, err := data.NewCategorizer(data.DefaultCategoryRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	categorizers := data.Categorizers{Default: categorizer}
+	tiers := data.Tiers{Default: data.DefaultTiers()}
+	stores, err := data.NewStores(categorizers, data.Quotas{}, data.ExpirationPolicies{}, tiers, data.DefaultRiskThreshold, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		store:   stores,
+		audit:   data.NewAuditLog(),
+		metrics: newAppMetrics(stores.Receipts),
+	}
+	app.config.auth = true
+
+	srv := httptest.NewServer(app.routes())
+	defer srv.Close()
+
+	adminKey := newTestAPIKey(t, stores.APIKeys, data.DefaultTenant, data.ScopeAdmin)
+	tenantAdminKey := newTestAPIKey(t, stores.APIKeys, "acme", data.ScopeAdmin)
+	readKey := newTestAPIKey(t, stores.APIKeys, data.DefaultTenant, data.ScopeReceiptsRead)
+
+	request := func(method, path, key, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	receipt := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"}],"total":"6.49"}`
+	if res := request(http.MethodPost, "/v1/receipts/process", adminKey, receipt); res.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /v1/receipts/process: got status %d; want %d", res.StatusCode, http.StatusCreated)
+	}
+
+	if res := request("BREW", "/coffee", "", ""); res.StatusCode == http.StatusOK {
+		t.Fatalf("BREW /coffee: got status %d; want an error", res.StatusCode)
+	}
+
+	for _, tt := range []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "without the admin scope", key: readKey, want: http.StatusForbidden},
+		{name: "admin of another tenant", key: tenantAdminKey, want: http.StatusForbidden},
+	} {
+		if res := request(http.MethodGet, "/metrics", tt.key, ""); res.StatusCode != tt.want {
+			t.Errorf("GET /metrics %s: got status %d; want %d", tt.name, res.StatusCode, tt.want)
+		}
+	}
+
+	res := request(http.MethodGet, "/metrics", adminKey, "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics: got status %d; want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("Content-Type = %q; want %q", got, metrics.ContentType)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+
+	for _, want := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{method="POST",route="/v1/receipts/process",status="201"} 1`,
+		`http_requests_total{method="GET",route="/metrics",status="401"} 1`,
+		`http_requests_total{method="GET",route="/metrics",status="403"} 2`,
+		`http_requests_total{method="other",route="unmatched",`,
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_count{method="POST",route="/v1/receipts/process",status="201"} 1`,
+		"receipts_stored 1",
+		"# TYPE go_goroutines gauge",
+		"# TYPE go_memstats_heap_alloc_bytes gauge",
+		"# TYPE go_gc_cycles_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics are missing %q", want)
+		}
+	}
+	if strings.Contains(body, `method="BREW"`) {
+		t.Error("metrics are labelled with a non-standard method; want it counted as other")
+	}
+	if strings.Contains(body, "go_memstats_heap_alloc_bytes 0\n") {
+		t.Error("go_memstats_heap_alloc_bytes is 0; want the heap in use")
+	}
+}
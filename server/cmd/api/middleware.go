@@ -1,10 +1,102 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/jwt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Request ids taken from the X-Request-ID header must be short and safe to log.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// statusRecorder remembers the status code and counts the body bytes written by the
+// handlers it wraps.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap() lets http.ResponseController reach the underlying ResponseWriter.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequests() gives every request an id, taken from its X-Request-ID header when that
+// holds a usable id and generated otherwise, and returns it in the X-Request-ID response
+// header. Once the request has been served it is logged with its outcome and counted in
+// the request metrics under its route, or 'unmatched' when no route matched.
+func (app *application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		info := &requestInfo{ID: r.Header.Get("X-Request-ID")}
+		if !requestIDRX.MatchString(info.ID) {
+			info.ID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", info.ID)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, app.contextSetRequestInfo(r, info))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		duration := time.Since(start)
+		route := info.Route
+		if route == "" {
+			route = "unmatched"
+		}
+		// Clients choose the method, so methods outside the standard set share a label
+		// rather than each adding series.
+		method := r.Method
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		default:
+			method = "other"
+		}
+		status := strconv.Itoa(rec.status)
+		app.metrics.requests.Inc(method, route, status)
+		app.metrics.requestDuration.Observe(duration.Seconds(), method, route, status)
+
+		app.logger.Info("request",
+			"request_id", info.ID,
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"route", info.Route,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", duration,
+			"ip", clientIP(r),
+		)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -16,3 +108,112 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticate() identifies the caller from a JWT in an 'Authorization: Bearer' header
+// or an API key in the X-API-Key header and adds it to the request context. Requests
+// without credentials continue anonymously, so that requireScope() can decide per route
+// whether they are needed.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
+
+		if !app.config.auth {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if authorizationHeader := r.Header.Get("Authorization"); authorizationHeader != "" {
+			scheme, token, ok := strings.Cut(authorizationHeader, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || app.verifier == nil {
+				app.invalidAuthenticationTokenResponse(w, r, errors.New("bearer token authentication is not supported"))
+				return
+			}
+
+			claims, err := app.verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r, err)
+				return
+			}
+
+			// The tenant claim keys every tenant-scoped lookup, so it must be a
+			// valid tenant name like those of API keys.
+			v := validator.New()
+			if claims.Tenant != "" {
+				data.ValidateTenant(v, claims.Tenant)
+			}
+			if !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r, fmt.Errorf("%w: 'tenant' %s", jwt.ErrClaims, v.Errors["tenant"]))
+				return
+			}
+
+			next.ServeHTTP(w, app.contextSetPrincipal(r, &principal{
+				Subject: claims.Subject,
+				Tenant:  claims.Tenant,
+				Scopes:  claims.ScopeList(),
+			}))
+			return
+		}
+
+		token := r.Header.Get("X-API-Key")
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := app.store.APIKeys.GetForToken(token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAPIKeyResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, app.contextSetPrincipal(r, &principal{
+			Subject: "apikey:" + key.ID.String(),
+			Tenant:  key.Tenant,
+			Scopes:  key.Scopes,
+			APIKey:  key,
+		}))
+	})
+}
+
+// requireScope() wraps a handler so it is only reached by callers granted scope. It
+// lets every request through when authentication is disabled.
+func (app *application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.auth {
+			next(w, r)
+			return
+		}
+
+		p := app.contextGetPrincipal(r)
+		if p == nil {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		if !data.HasScope(p.Scopes, scope) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requireDefaultTenant() wraps a handler so it is only reached by callers of the
+// default tenant, for endpoints that act on data shared by every tenant. It is used
+// inside requireScope(), which decides whether the caller is authenticated at all.
+func (app *application) requireDefaultTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.requestTenant(r) != data.DefaultTenant {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
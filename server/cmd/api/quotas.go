@@ -0,0 +1,24 @@
+package main
+
+import (
+	"html"
+	"net/http"
+)
+
+// GetQuotaHandler for the 'Get /v1/quota' endpoint. Reports the caller's daily quotas,
+// including the per-retailer quota of the optional 'retailer'. Receipts count against
+// the retailer they match in the retailer catalog, so the retailer is looked up there
+// the same way.
+func (app *application) getQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	retailer := html.UnescapeString(app.readString(r.URL.Query(), "retailer", ""))
+	if match, ok := app.store.Retailers.Match(retailer); retailer != "" && ok {
+		retailer = match.Name
+	}
+
+	usage := app.store.Quotas.Usage(app.requestTenant(r), app.requestSubject(r), retailer)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"quota": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often idle limiter entries are looked for and removed.
+const limiterCleanupInterval = time.Minute
+
+// rateLimit is a token bucket rate: rps tokens are added per second, up to burst.
+type rateLimit struct {
+	rps   float64
+	burst int
+}
+
+// routeLimit applies a rateLimit to the requests whose method matches and whose path
+// starts with prefix.
+type routeLimit struct {
+	method string
+	prefix string
+	limit  rateLimit
+}
+
+// parseRouteLimit() parses a -limiter-route value of the form
+// 'METHOD /path/prefix=rps:burst'.
+func parseRouteLimit(s string) (routeLimit, error) {
+	route, rate, ok := strings.Cut(s, "=")
+	method, prefix, ok2 := strings.Cut(strings.TrimSpace(route), " ")
+	rps, burst, ok3 := strings.Cut(rate, ":")
+	if !ok || !ok2 || !ok3 || !strings.HasPrefix(prefix, "/") {
+		return routeLimit{}, fmt.Errorf("invalid route limit %q, want 'METHOD /path=rps:burst'", s)
+	}
+
+	rl := routeLimit{method: strings.ToUpper(method), prefix: prefix}
+	var err error
+	rl.limit.rps, err = strconv.ParseFloat(rps, 64)
+	if err != nil || rl.limit.rps <= 0 {
+		return routeLimit{}, fmt.Errorf("invalid route limit %q: rps must be a positive number", s)
+	}
+	rl.limit.burst, err = strconv.Atoi(burst)
+	if err != nil || rl.limit.burst < 1 {
+		return routeLimit{}, fmt.Errorf("invalid route limit %q: burst must be a positive integer", s)
+	}
+
+	return rl, nil
+}
+
+// tokenBucket holds up to burst tokens and refills continuously at rps tokens per
+// second. Every request takes one token.
+type tokenBucket struct {
+	limit    rateLimit
+	tokens   float64
+	last     time.Time
+	lastSeen time.Time
+}
+
+func newTokenBucket(limit rateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.burst), last: now, lastSeen: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.rps)
+	b.last = now
+}
+
+// take() takes a token if one is available. It returns the tokens left, and how long
+// until the next token (when none was available) or until the bucket is full again.
+func (b *tokenBucket) take(now time.Time) (ok bool, remaining int, retryAfter, reset time.Duration) {
+	b.refill(now)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retryAfter = time.Duration((1 - b.tokens) / b.limit.rps * float64(time.Second))
+	}
+	reset = time.Duration((float64(b.limit.burst) - b.tokens) / b.limit.rps * float64(time.Second))
+
+	return ok, int(b.tokens), retryAfter, reset
+}
+
+// idle() reports whether the bucket has refilled completely, at which point it is no
+// different from a new one and can be dropped.
+func (b *tokenBucket) idle(now time.Time) bool {
+	return now.Sub(b.lastSeen).Seconds()*b.limit.rps >= float64(b.limit.burst)
+}
+
+// rateLimiter keeps a token bucket per client and route limit.
+type rateLimiter struct {
+	mu      sync.Mutex
+	def     rateLimit
+	routes  []routeLimit
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(def rateLimit, routes []routeLimit) *rateLimiter {
+	// The longest matching prefix wins, so check longer prefixes first.
+	routes = slices.Clone(routes)
+	slices.SortStableFunc(routes, func(a, b routeLimit) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+
+	return &rateLimiter{
+		def:     def,
+		routes:  routes,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// limitFor() returns the route limit that applies to the request along with a name for
+// it, which keeps the buckets of different route limits apart.
+func (l *rateLimiter) limitFor(r *http.Request) (string, rateLimit) {
+	for _, rl := range l.routes {
+		if rl.method == r.Method && strings.HasPrefix(r.URL.Path, rl.prefix) {
+			return rl.method + " " + rl.prefix, rl.limit
+		}
+	}
+
+	return "default", l.def
+}
+
+func (l *rateLimiter) take(key string, limit rateLimit) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = newTokenBucket(limit, now)
+		l.buckets[key] = bucket
+	}
+
+	return bucket.take(now)
+}
+
+// cleanup() removes idle buckets every limiterCleanupInterval, for as long as the
+// process runs.
+func (l *rateLimiter) cleanup() {
+	for {
+		time.Sleep(limiterCleanupInterval)
+
+		l.mu.Lock()
+		now := time.Now()
+		for key, bucket := range l.buckets {
+			if bucket.idle(now) {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// rateLimitClient() identifies the client a request is counted against: the API key or
+// token subject it authenticated with, or else its IP address.
+func (app *application) rateLimitClient(r *http.Request) string {
+	if p := app.contextGetPrincipal(r); p != nil {
+		if p.APIKey != nil {
+			return "key:" + p.APIKey.ID.String()
+		}
+		return "sub:" + p.Tenant + "/" + p.Subject
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// allowRequest() takes a token from the bucket with the given key, reporting the quota
+// in RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. When no token is
+// left it writes a 429 with a Retry-After header and returns false.
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, key string, limit rateLimit) bool {
+	ok, remaining, retryAfter, reset := app.limiter.take(key, limit)
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+	if !ok {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+	}
+	return ok
+}
+
+// ipRateLimit() limits every IP address to the -limiter-ip-rps rate across all routes.
+// It runs before authenticate(), so floods of requests with bad credentials and API key
+// guessing are limited as well.
+func (app *application) ipRateLimit(next http.Handler) http.Handler {
+	limit := rateLimit{rps: app.config.limiter.ipRPS, burst: app.config.limiter.ipBurst}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if app.allowRequest(w, r, "ip|"+clientIP(r), limit) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// rateLimit() limits every client to the rate configured for the route it requests,
+// replacing the RateLimit headers set by ipRateLimit() with its own quota.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, limit := app.limiter.limitFor(r)
+		if app.allowRequest(w, r, route+"|"+app.rateLimitClient(r), limit) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
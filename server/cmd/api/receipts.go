@@ -5,11 +5,21 @@ import (
 	"fmt"
 	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
 	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"mime"
 	"net/http"
+	"slices"
 )
 
-// ProcessReceiptHandler for the 'Post /v1/receipts/process' endpoint.
+// ProcessReceiptHandler for the 'Post /v1/receipts/process' endpoint. Plain-text
+// receipts ('Content-Type: text/plain') are handed to processTextReceiptHandler. With
+// '?async=true' a valid receipt is queued for processing and a job is returned. The
+// receipt is attributed to the authenticated caller's subject.
 func (app *application) processReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/plain" {
+		app.processTextReceiptHandler(w, r)
+		return
+	}
+
 	var input struct {
 		Retailer     string `json:"retailer"`
 		PurchaseDate string `json:"purchaseDate"`
@@ -40,6 +50,8 @@ func (app *application) processReceiptHandler(w http.ResponseWriter, r *http.Req
 		PurchaseTime: input.PurchaseTime,
 		Items:        items,
 		Total:        input.Total,
+		Tenant:       app.requestTenant(r),
+		AccountID:    app.requestSubject(r),
 	}
 
 	v := validator.New()
@@ -48,24 +60,88 @@ func (app *application) processReceiptHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.store.Receipts.Insert(receipt)
+	if app.readBool(r.URL.Query(), "async") {
+		app.enqueueReceipt(w, r, receipt, nil)
+		return
+	}
+
+	app.storeReceipt(w, r, receipt, nil)
+}
+
+// processTextReceiptHandler() handles plain-text receipts posted to
+// 'Post /v1/receipts/process'. The text is parsed with the configured receipt layouts
+// and the response includes the parser's confidence and any lines it couldn't parse.
+func (app *application) processTextReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	text, err := app.readText(w, r)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	result := app.parser.Parse(text)
+	receipt := result.Receipt
+	receipt.Tenant = app.requestTenant(r)
+	receipt.AccountID = app.requestSubject(r)
+
+	v := validator.New()
+	if data.ValidateReceipt(v, receipt); !v.Valid() {
+		app.failedParseResponse(w, r, v.Errors, result)
+		return
+	}
+
+	if app.readBool(r.URL.Query(), "async") {
+		app.enqueueReceipt(w, r, receipt, envelope{"parse": result})
 		return
 	}
 
+	app.storeReceipt(w, r, receipt, envelope{"parse": result})
+}
+
+// storeReceipt() inserts a validated receipt and writes a 201 Created response
+// containing it, merged with any extra envelope fields. Receipts over their account's
+// quota get the quota exceeded response instead.
+func (app *application) storeReceipt(w http.ResponseWriter, r *http.Request, receipt *data.Receipt, extra envelope) {
+	err := app.store.Receipts.Insert(receipt)
+	if err != nil {
+		var quotaErr *data.QuotaExceededError
+		switch {
+		case errors.As(err, &quotaErr):
+			app.quotaExceededResponse(w, r, quotaErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "receipt:"+receipt.ID.String(), nil, receipt)
+
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/receipts/%d", receipt.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/receipts/%s", receipt.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"points": receipt}, headers)
+	jsnEnv := envelope{"points": receipt}
+	for key, value := range extra {
+		jsnEnv[key] = value
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, jsnEnv, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-// GetReceiptHandler for the 'Get /v1/receipts' endpoint.
+// GetReceiptHandler for the 'Get /v1/receipts' endpoint. Accepts optional 'retailer',
+// 'from' and 'to' filters, and a 'status' of pending, approved or rejected ('held=true'
+// still works as an alias of 'status=pending').
 func (app *application) getReceiptListHandler(w http.ResponseWriter, r *http.Request) {
-	receipts, err := app.store.Receipts.GetAll()
+	filters := app.readReceiptFilters(r.URL.Query())
+
+	v := validator.New()
+	if data.ValidateReceiptFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	receipts, err := app.store.Receipts.GetAll(app.requestTenant(r), filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -85,7 +161,7 @@ func (app *application) getReceiptHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	receipt, err := app.store.Receipts.Get(id)
+	receipt, err := app.store.Receipts.Get(app.requestTenant(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -110,7 +186,44 @@ func (app *application) getReceiptPointsHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	receipt, err := app.store.Receipts.Get(id)
+	receipt, err := app.store.Receipts.Get(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	jsnEnv := envelope{"points": receipt.Points}
+	if receipt.Status != data.StatusApproved {
+		jsnEnv["pendingPoints"] = receipt.PendingPoints
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsnEnv, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// UpdateReceiptItemCategoryHandler for the 'Patch /v1/receipts/:id/items/:index' endpoint.
+// It manually overrides the category assigned to a receipt item by the categorizer.
+func (app *application) updateReceiptItemCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	index, err := app.itemIndexParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	receipt, err := app.store.Receipts.Get(app.requestTenant(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -121,7 +234,78 @@ func (app *application) getReceiptPointsHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"points": receipt.Points}, nil)
+	if index >= len(receipt.Items) {
+		app.notFoundResponse(w, r)
+		return
+	}
+	before := *receipt
+
+	var input struct {
+		Category string `json:"category"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Category != "", "category", "must be provided")
+	v.Check(validator.PermittedValue(input.Category, app.store.Receipts.Categories(receipt.Tenant)...), "category", "must be a known category")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items := slices.Clone(receipt.Items)
+	items[index].Category = input.Category
+	items[index].CategoryOverride = true
+	receipt.Items = items
+
+	err = app.store.Receipts.Update(receipt)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "receipt:"+receipt.ID.String(), before, receipt)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"receipt": receipt}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteReceiptHandler for the 'Delete /v1/receipts/:id' endpoint.
+func (app *application) deleteReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	receipt, err := app.store.Receipts.Delete(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "receipt:"+receipt.ID.String(), receipt, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "receipt successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
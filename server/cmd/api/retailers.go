@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"net/http"
+)
+
+// CreateRetailerHandler for the 'Post /v1/admin/retailers' endpoint. The retailer
+// catalog is shared by every tenant, so only admins of the default tenant may change it.
+func (app *application) createRetailerHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string   `json:"name"`
+		Aliases  []string `json:"aliases"`
+		Patterns []string `json:"patterns"`
+		Category string   `json:"category"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	retailer := &data.Retailer{
+		Name:     input.Name,
+		Aliases:  input.Aliases,
+		Patterns: input.Patterns,
+		Category: input.Category,
+	}
+
+	v := validator.New()
+	if data.ValidateRetailer(v, retailer); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Retailers.Insert(retailer)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRetailer):
+			v.AddError("name", "a retailer with this name or alias already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "retailer:"+retailer.ID.String(), nil, retailer)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/retailers/%s", retailer.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"retailer": retailer}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ListRetailersHandler for the 'Get /v1/admin/retailers' endpoint.
+func (app *application) listRetailersHandler(w http.ResponseWriter, r *http.Request) {
+	retailers, err := app.store.Retailers.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"retailers": retailers}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ShowRetailerHandler for the 'Get /v1/admin/retailers/:id' endpoint.
+func (app *application) showRetailerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	retailer, err := app.store.Retailers.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"retailer": retailer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// UpdateRetailerHandler for the 'Patch /v1/admin/retailers/:id' endpoint. Only the
+// fields present in the request body are changed, and only by default tenant admins.
+func (app *application) updateRetailerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	retailer, err := app.store.Retailers.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *retailer
+
+	var input struct {
+		Name     *string  `json:"name"`
+		Aliases  []string `json:"aliases"`
+		Patterns []string `json:"patterns"`
+		Category *string  `json:"category"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		retailer.Name = *input.Name
+	}
+	if input.Aliases != nil {
+		retailer.Aliases = input.Aliases
+	}
+	if input.Patterns != nil {
+		retailer.Patterns = input.Patterns
+	}
+	if input.Category != nil {
+		retailer.Category = *input.Category
+	}
+
+	v := validator.New()
+	if data.ValidateRetailer(v, retailer); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Retailers.Update(retailer)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRetailer):
+			v.AddError("name", "a retailer with this name or alias already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "retailer:"+retailer.ID.String(), before, retailer)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"retailer": retailer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteRetailerHandler for the 'Delete /v1/admin/retailers/:id' endpoint, for default
+// tenant admins only.
+func (app *application) deleteRetailerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	retailer, err := app.store.Retailers.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "retailer:"+retailer.ID.String(), retailer, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "retailer successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"net/http"
+	"time"
+)
+
+// ListReviewHandler for the 'Get /v1/admin/review' endpoint. Lists the tenant's receipts
+// held for review, oldest first.
+func (app *application) listReviewHandler(w http.ResponseWriter, r *http.Request) {
+	receipts, err := app.store.Receipts.GetAll(app.requestTenant(r), data.ReceiptFilters{Status: data.StatusPending})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"receipts": receipts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ReviewDecisionHandler for the 'Post /v1/admin/review/:id/decision' endpoint. Approves
+// a held receipt, awarding its points, or rejects it with a reason. The decision and the
+// reviewer are recorded on the receipt.
+func (app *application) reviewDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Decision string `json:"decision"`
+		Reason   string `json:"reason"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := data.Review{
+		Decision: input.Decision,
+		Reason:   input.Reason,
+		Reviewer: app.requestSubject(r),
+		At:       time.Now(),
+	}
+
+	v := validator.New()
+	if data.ValidateReview(v, &review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	receipt, err := app.store.Receipts.Get(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *receipt
+	err = receipt.ApplyReview(review)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	err = app.store.Receipts.Update(receipt)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("receipt reviewed", "receipt", receipt.ID.String(), "tenant", receipt.Tenant, "decision", review.Decision, "reviewer", review.Reviewer)
+
+	app.auditChange(r, "receipt:"+receipt.ID.String(), before, receipt)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"receipt": receipt}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
@@ -12,14 +13,83 @@ func (app *application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/receipts/process", app.processReceiptHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/receipts", app.getReceiptListHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/receipts/:id", app.getReceiptHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/receipts/:id/points", app.getReceiptPointsHandler)
+	// handle() registers a route, noting its pattern on the request for the access log.
+	handle := func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+			if info := app.contextGetRequestInfo(r); info != nil {
+				info.Route = pattern
+			}
+			handler(w, r)
+		})
+	}
+
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	handle(http.MethodGet, "/metrics", app.requireScope(data.ScopeAdmin, app.requireDefaultTenant(app.metricsHandler)))
+	handle(http.MethodPost, "/v1/receipts/process", app.requireScope(data.ScopeReceiptsWrite, app.processReceiptHandler))
+	handle(http.MethodGet, "/v1/receipts", app.requireScope(data.ScopeReceiptsRead, app.getReceiptListHandler))
+	handle(http.MethodGet, "/v1/receipts/:id", app.requireScope(data.ScopeReceiptsRead, app.dispatchID(app.getReceiptHandler, map[string]http.HandlerFunc{
+		"export": app.exportReceiptsHandler,
+		"stream": app.streamReceiptsHandler,
+	})))
+	handle(http.MethodDelete, "/v1/receipts/:id", app.requireScope(data.ScopeReceiptsWrite, app.deleteReceiptHandler))
+	handle(http.MethodGet, "/v1/receipts/:id/points", app.requireScope(data.ScopeReceiptsRead, app.getReceiptPointsHandler))
+	handle(http.MethodPatch, "/v1/receipts/:id/items/:index", app.requireScope(data.ScopeReceiptsWrite, app.updateReceiptItemCategoryHandler))
+	handle(http.MethodGet, "/v1/jobs/:id", app.requireScope(data.ScopeReceiptsRead, app.getJobHandler))
+	handle(http.MethodGet, "/v1/quota", app.requireScope(data.ScopeReceiptsRead, app.getQuotaHandler))
+	handle(http.MethodGet, "/v1/accounts/:id/expirations", app.requireScope(data.ScopeReceiptsRead, app.getAccountExpirationsHandler))
+
+	handle(http.MethodGet, "/v1/stats", app.requireScope(data.ScopeReceiptsRead, app.getStatsHandler))
+	handle(http.MethodGet, "/v1/leaderboards/:kind", app.requireScope(data.ScopeReceiptsRead, app.getLeaderboardHandler))
+
+	handle(http.MethodPost, "/v1/admin/import", app.requireScope(data.ScopeAdmin, app.importReceiptsHandler))
+	handle(http.MethodPost, "/v1/admin/rebuild", app.requireScope(data.ScopeAdmin, app.requireDefaultTenant(app.rebuildReceiptsHandler)))
+	handle(http.MethodGet, "/v1/admin/audit", app.requireScope(data.ScopeAdmin, app.listAuditHandler))
+
+	handle(http.MethodGet, "/v1/admin/review", app.requireScope(data.ScopeAdmin, app.listReviewHandler))
+	handle(http.MethodPost, "/v1/admin/review/:id/decision", app.requireScope(data.ScopeAdmin, app.reviewDecisionHandler))
+
+	handle(http.MethodGet, "/v1/admin/campaigns", app.requireScope(data.ScopeAdmin, app.listCampaignsHandler))
+	handle(http.MethodPost, "/v1/admin/campaigns", app.requireScope(data.ScopeAdmin, app.createCampaignHandler))
+	handle(http.MethodGet, "/v1/admin/campaigns/:id", app.requireScope(data.ScopeAdmin, app.showCampaignHandler))
+	handle(http.MethodPatch, "/v1/admin/campaigns/:id", app.requireScope(data.ScopeAdmin, app.updateCampaignHandler))
+	handle(http.MethodDelete, "/v1/admin/campaigns/:id", app.requireScope(data.ScopeAdmin, app.deleteCampaignHandler))
+
+	handle(http.MethodGet, "/v1/admin/retailers", app.requireScope(data.ScopeAdmin, app.listRetailersHandler))
+	handle(http.MethodPost, "/v1/admin/retailers", app.requireScope(data.ScopeAdmin, app.requireDefaultTenant(app.createRetailerHandler)))
+	handle(http.MethodGet, "/v1/admin/retailers/:id", app.requireScope(data.ScopeAdmin, app.showRetailerHandler))
+	handle(http.MethodPatch, "/v1/admin/retailers/:id", app.requireScope(data.ScopeAdmin, app.requireDefaultTenant(app.updateRetailerHandler)))
+	handle(http.MethodDelete, "/v1/admin/retailers/:id", app.requireScope(data.ScopeAdmin, app.requireDefaultTenant(app.deleteRetailerHandler)))
+
+	handle(http.MethodGet, "/v1/admin/keys", app.requireScope(data.ScopeAdmin, app.listAPIKeysHandler))
+	handle(http.MethodPost, "/v1/admin/keys", app.requireScope(data.ScopeAdmin, app.createAPIKeyHandler))
+	handle(http.MethodGet, "/v1/admin/keys/:id", app.requireScope(data.ScopeAdmin, app.showAPIKeyHandler))
+	handle(http.MethodDelete, "/v1/admin/keys/:id", app.requireScope(data.ScopeAdmin, app.deleteAPIKeyHandler))
+
+	handle(http.MethodGet, "/v1/admin/webhooks", app.requireScope(data.ScopeAdmin, app.listWebhooksHandler))
+	handle(http.MethodPost, "/v1/admin/webhooks", app.requireScope(data.ScopeAdmin, app.createWebhookHandler))
+	handle(http.MethodGet, "/v1/admin/webhooks/:id", app.requireScope(data.ScopeAdmin, app.showWebhookHandler))
+	handle(http.MethodPatch, "/v1/admin/webhooks/:id", app.requireScope(data.ScopeAdmin, app.updateWebhookHandler))
+	handle(http.MethodDelete, "/v1/admin/webhooks/:id", app.requireScope(data.ScopeAdmin, app.deleteWebhookHandler))
+	handle(http.MethodGet, "/v1/admin/webhooks/:id/deliveries", app.requireScope(data.ScopeAdmin, app.listWebhookDeliveriesHandler))
+	handle(http.MethodGet, "/v1/admin/webhooks/:id/dead-letters", app.requireScope(data.ScopeAdmin, app.listWebhookDeadLettersHandler))
 	//router.HandleFunc("/v1/healthcheck", app.healthcheckHandler, "GET")
 	//router.HandleFunc("/v1/receipts/process", app.processReceiptHandler, "POST")
 	//router.HandleFunc("/v1/receipts/{:id}/points", app.getReceiptHandler, "GET")
 
-	return app.recoverPanic(router)
+	return app.logRequests(app.recoverPanic(app.ipRateLimit(app.authenticate(app.rateLimit(app.auditRequests(router))))))
+}
+
+// dispatchID() works around httprouter refusing to register static segments such as
+// '/v1/receipts/export' or '/v1/receipts/stream' alongside an ':id' wildcard at the same position. The wildcard
+// route is registered once and requests whose id matches one of the static names are
+// handed to that handler instead.
+func (app *application) dispatchID(next http.HandlerFunc, static map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+		if handler, exists := static[id]; exists {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve() starts the HTTP server and blocks until it stops. On SIGINT or SIGTERM the
+// server stops accepting requests, in-flight requests are given up to 30 seconds to
+// complete, and the background workers are then drained within the same deadline.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	// Open event streams would otherwise keep Shutdown waiting for its deadline.
+	srv.RegisterOnShutdown(app.stream.close)
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.Info("draining background jobs", "addr", srv.Addr)
+		err = app.expiry.shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		err = app.jobs.shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		err = app.store.Events.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		shutdownError <- app.webhooks.shutdown(ctx)
+	}()
+
+	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env)
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", srv.Addr)
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"net/http"
+)
+
+// GetStatsHandler for the 'Get /v1/stats' endpoint. Accepts optional 'from' and 'to'
+// purchase dates and a 'group_by' of day, week, month or retailer. Stats are eventually
+// consistent: they catch up with a stored, changed or deleted receipt shortly after the
+// request that made the change has been answered.
+func (app *application) getStatsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	filters := data.StatsFilters{
+		From:    app.readString(qs, "from", ""),
+		To:      app.readString(qs, "to", ""),
+		GroupBy: app.readString(qs, "group_by", ""),
+	}
+
+	v := validator.New()
+	if data.ValidateStatsFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, groups, err := app.store.Stats.Get(app.requestTenant(r), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	jsnEnv := envelope{"stats": stats}
+	if filters.GroupBy != "" {
+		jsnEnv["groups"] = groups
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsnEnv, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
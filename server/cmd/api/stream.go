@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of past events kept for clients resuming with Last-Event-ID.
+	streamBufferSize = 1000
+	// Number of events a subscriber may fall behind before it is disconnected.
+	streamSubscriberBuffer = 64
+	streamHeartbeat        = 15 * time.Second
+)
+
+type receiptEvent struct {
+	seq       int64
+	tenant    string
+	ID        uuid.UUID `json:"id"`
+	Retailer  string    `json:"retailer"`
+	Points    int32     `json:"points"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type streamSubscriber struct {
+	tenant string
+	events chan receiptEvent
+	// closed once the subscriber has fallen too far behind or the broker shuts down.
+	done chan struct{}
+}
+
+// receiptBroker fans processed receipts out to the Server-Sent Events subscribers of
+// their tenant. It keeps a bounded ring buffer of recent events so that reconnecting
+// clients can resume, and never blocks publishers: a subscriber that can't keep up is
+// disconnected and has to resume from the buffer.
+//
+// Event IDs are "<epoch>-<seq>", where the epoch is the time the broker started. The
+// sequence restarts with the server, so the epoch tells IDs of an earlier run apart.
+type receiptBroker struct {
+	mu          sync.Mutex
+	epoch       int64
+	seq         int64
+	buffer      []receiptEvent
+	subscribers map[*streamSubscriber]struct{}
+	closed      bool
+}
+
+func newReceiptBroker() *receiptBroker {
+	return &receiptBroker{
+		epoch:       time.Now().UnixMilli(),
+		buffer:      make([]receiptEvent, 0, streamBufferSize),
+		subscribers: make(map[*streamSubscriber]struct{}),
+	}
+}
+
+func (b *receiptBroker) publish(receipt *data.Receipt) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := receiptEvent{
+		seq:       b.seq,
+		tenant:    receipt.Tenant,
+		ID:        receipt.ID,
+		Retailer:  receipt.Retailer,
+		Points:    receipt.Points,
+		CreatedAt: receipt.CreatedAt,
+	}
+
+	if len(b.buffer) == streamBufferSize {
+		b.buffer = append(b.buffer[:0], b.buffer[1:]...)
+	}
+	b.buffer = append(b.buffer, event)
+
+	for sub := range b.subscribers {
+		if sub.tenant != event.tenant {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.done)
+		}
+	}
+}
+
+// handle() publishes newly created receipts from the store's event bus.
+func (b *receiptBroker) handle(event data.Event) error {
+	if e, ok := event.(data.ReceiptCreated); ok {
+		b.publish(&e.Receipt)
+	}
+
+	return nil
+}
+
+// eventID() returns the ID of the event with the sequence number.
+func (b *receiptBroker) eventID(seq int64) string {
+	return fmt.Sprintf("%d-%d", b.epoch, seq)
+}
+
+// parseEventID() splits an event ID into its epoch and sequence number. A bare sequence
+// number has epoch 0.
+func parseEventID(id string) (epoch, seq int64, err error) {
+	epochPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		epochPart, seqPart = "0", id
+	}
+
+	epoch, err = strconv.ParseInt(epochPart, 10, 64)
+	if err == nil {
+		seq, err = strconv.ParseInt(seqPart, 10, 64)
+	}
+	if err != nil || epoch < 0 || seq < 0 {
+		return 0, 0, fmt.Errorf("invalid event id %q", id)
+	}
+
+	return epoch, seq, nil
+}
+
+// subscribe() registers a subscriber for the tenant's receipts and returns the tenant's
+// buffered events published after the event with the given epoch and sequence number,
+// which the caller sends before reading from the subscriber. An event from another run
+// of the broker, or one it hasn't published, is unknown and the whole buffer is
+// returned.
+func (b *receiptBroker) subscribe(tenant string, epoch, lastSeq int64) (*streamSubscriber, []receiptEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &streamSubscriber{
+		tenant: tenant,
+		events: make(chan receiptEvent, streamSubscriberBuffer),
+		done:   make(chan struct{}),
+	}
+	if b.closed {
+		close(sub.done)
+		return sub, nil
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if epoch != b.epoch || lastSeq > b.seq {
+		lastSeq = 0
+	}
+
+	var backlog []receiptEvent
+	for _, event := range b.buffer {
+		if event.tenant == tenant && event.seq > lastSeq {
+			backlog = append(backlog, event)
+		}
+	}
+
+	return sub, backlog
+}
+
+func (b *receiptBroker) unsubscribe(sub *streamSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.subscribers[sub]; exists {
+		delete(b.subscribers, sub)
+		close(sub.done)
+	}
+}
+
+// close() disconnects every subscriber so that open streams don't hold up a graceful
+// shutdown.
+func (b *receiptBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.done)
+	}
+}
+
+// StreamReceiptsHandler for the 'Get /v1/receipts/stream' endpoint. Emits a 'receipt'
+// Server-Sent Event for each processed receipt. Clients resume after a disconnect with
+// the Last-Event-ID header (or 'lastEventId' query parameter), as far back as the
+// broker's buffer reaches. Clients resuming after a restart get the whole buffer.
+func (app *application) streamReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+
+	var epoch, since int64
+	if lastID != "" {
+		var err error
+		epoch, since, err = parseEventID(lastID)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid Last-Event-ID %q", lastID))
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sub, backlog := app.stream.subscribe(app.requestTenant(r), epoch, since)
+	defer app.stream.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event receiptEvent) error {
+		jsn, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %s\nevent: receipt\ndata: %s\n\n", app.stream.eventID(event.seq), jsn)
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	for _, event := range backlog {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-sub.events:
+			if err := send(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-sub.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookWorkers     = 4
+	webhookQueueSize   = 1000
+	webhookMaxAttempts = 6
+	webhookBackoff     = 500 * time.Millisecond
+	webhookTimeout     = 5 * time.Second
+)
+
+// webhookTask is one event waiting to be delivered to one webhook.
+type webhookTask struct {
+	webhook  data.Webhook
+	delivery data.Delivery
+	body     []byte
+}
+
+// webhookRetry is a task waiting on its timer to be queued again after a failed attempt.
+type webhookRetry struct {
+	timer *time.Timer
+	task  webhookTask
+	err   error
+}
+
+// webhookDispatcher delivers receipt events to webhook subscribers in the background,
+// retrying failed deliveries with exponential backoff before dead-lettering them.
+// Retries wait on a timer rather than in a worker, so a dead endpoint doesn't hold up
+// the deliveries of other webhooks.
+type webhookDispatcher struct {
+	client  *http.Client
+	store   data.WebhookModel
+	logger  *slog.Logger
+	queue   chan webhookTask
+	workers sync.WaitGroup
+	pending sync.WaitGroup
+	mu      sync.Mutex
+	closed  bool
+	retries map[uuid.UUID]*webhookRetry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	backoff time.Duration
+}
+
+func newWebhookDispatcher(store data.WebhookModel, logger *slog.Logger) *webhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhookDispatcher{
+		client:  newWebhookClient(),
+		store:   store,
+		logger:  logger,
+		queue:   make(chan webhookTask, webhookQueueSize),
+		retries: make(map[uuid.UUID]*webhookRetry),
+		ctx:     ctx,
+		cancel:  cancel,
+		backoff: webhookBackoff,
+	}
+}
+
+// newWebhookClient() returns the HTTP client deliveries are sent with. It checks every
+// address it connects to, including those of redirects, with data.WebhookAddrAllowed,
+// so a host name that resolves to a private address is refused as well. Proxies aren't
+// used, as they would connect on the client's behalf.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !data.WebhookAddrAllowed(addrPort.Addr()) {
+				return fmt.Errorf("webhook address %s is not allowed", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: webhookTimeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// start() launches the delivery workers.
+func (d *webhookDispatcher) start() {
+	for range webhookWorkers {
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+			for task := range d.queue {
+				d.deliver(task)
+			}
+		}()
+	}
+}
+
+// dispatch() queues the event for every active webhook of the tenant subscribed to it.
+// It never blocks: when the queue is full the delivery is dead-lettered straight away.
+func (d *webhookDispatcher) dispatch(tenant, event string, payload any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+
+	for _, webhook := range d.store.Subscribers(tenant, event) {
+		now := time.Now()
+		delivery := data.Delivery{
+			ID:        uuid.New(),
+			WebhookID: webhook.ID,
+			Event:     event,
+			Status:    data.DeliveryPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		body, err := json.Marshal(map[string]any{
+			"id":        delivery.ID,
+			"event":     event,
+			"createdAt": now,
+			"data":      payload,
+		})
+		if err != nil {
+			d.fail(delivery, err)
+			continue
+		}
+
+		// The delivery is counted and recorded before it is queued, as a worker may
+		// finish it before the send returns.
+		d.pending.Add(1)
+		d.store.RecordDelivery(delivery)
+		select {
+		case d.queue <- webhookTask{webhook: *webhook, delivery: delivery, body: body}:
+		default:
+			d.pending.Done()
+			d.fail(delivery, errors.New("webhook delivery queue is full"))
+		}
+	}
+}
+
+func (d *webhookDispatcher) fail(delivery data.Delivery, err error) {
+	delivery.Status = data.DeliveryDead
+	delivery.Error = err.Error()
+	delivery.UpdatedAt = time.Now()
+	d.store.RecordDelivery(delivery)
+	d.logger.Error(err.Error(), "webhook", delivery.WebhookID.String(), "delivery", delivery.ID.String())
+}
+
+// deliver() makes one attempt at a delivery. A failed attempt is retried after
+// backoff * 2^(attempt-1) plus jitter until the attempts run out or the dispatcher is
+// shut down.
+func (d *webhookDispatcher) deliver(task webhookTask) {
+	delivery := &task.delivery
+	delivery.Attempts++
+	status, err := d.send(task)
+	delivery.ResponseStatus = status
+	delivery.UpdatedAt = time.Now()
+
+	switch {
+	case err == nil:
+		delivery.Status = data.DeliveryDelivered
+		delivery.Error = ""
+		d.store.RecordDelivery(*delivery)
+		d.pending.Done()
+	case delivery.Attempts >= webhookMaxAttempts:
+		d.fail(*delivery, err)
+		d.pending.Done()
+	default:
+		delivery.Error = err.Error()
+		d.store.RecordDelivery(*delivery)
+
+		wait := d.backoff << (delivery.Attempts - 1)
+		wait += rand.N(wait/2 + 1)
+		d.retry(task, wait, err)
+	}
+}
+
+// retry() queues the task again once wait has passed. The wait happens on a timer, and
+// the timer is dropped on shutdown to dead-letter the task instead.
+func (d *webhookDispatcher) retry(task webhookTask, wait time.Duration, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ctx.Err() != nil {
+		d.fail(task.delivery, fmt.Errorf("shut down before delivery succeeded: %w", err))
+		d.pending.Done()
+		return
+	}
+
+	id := task.delivery.ID
+	timer := time.AfterFunc(wait, func() {
+		d.mu.Lock()
+		_, scheduled := d.retries[id]
+		delete(d.retries, id)
+		d.mu.Unlock()
+		if !scheduled {
+			return
+		}
+
+		select {
+		case d.queue <- task:
+		case <-d.ctx.Done():
+			d.fail(task.delivery, fmt.Errorf("shut down before delivery succeeded: %w", err))
+			d.pending.Done()
+		}
+	})
+	d.retries[id] = &webhookRetry{timer: timer, task: task, err: err}
+}
+
+// send() POSTs the payload to the webhook, signed with HMAC-SHA256 over
+// "<timestamp>.<body>" using the webhook secret.
+func (d *webhookDispatcher) send(task webhookTask) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, task.webhook.URL, bytes.NewReader(task.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", task.delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", task.delivery.ID.String())
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(task.webhook.Secret, timestamp, task.body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook responded with %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// handle() translates receipt and tier events from the store's event bus into webhook
+// events.
+func (d *webhookDispatcher) handle(event data.Event) error {
+	switch e := event.(type) {
+	case data.ReceiptCreated:
+		d.dispatch(e.Receipt.Tenant, data.EventReceiptProcessed, e.Receipt)
+	case data.ReceiptUpdated:
+		d.dispatch(e.After.Tenant, data.EventReceiptUpdated, e.After)
+	case data.ReceiptDeleted:
+		d.dispatch(e.Receipt.Tenant, data.EventReceiptDeleted, e.Receipt)
+	case data.TierChanged:
+		d.dispatch(e.Tenant, data.EventTierChanged, map[string]any{
+			"accountId": e.AccountID,
+			"before":    e.Before,
+			"after":     e.After,
+			"at":        e.At,
+		})
+	}
+
+	return nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// shutdown() stops accepting events and waits for queued deliveries and their retries to
+// finish. Deliveries still waiting to be retried when the context is done are
+// dead-lettered.
+func (d *webhookDispatcher) shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		d.cancel()
+
+		d.mu.Lock()
+		for id, retry := range d.retries {
+			retry.timer.Stop()
+			delete(d.retries, id)
+			d.fail(retry.task.delivery, fmt.Errorf("shut down before delivery succeeded: %w", retry.err))
+			d.pending.Done()
+		}
+		d.mu.Unlock()
+		<-done
+	}
+
+	close(d.queue)
+	d.workers.Wait()
+	d.cancel()
+	return err
+}
+
+// CreateWebhookHandler for the 'Post /v1/admin/webhooks' endpoint.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		Tenant: app.requestTenant(r),
+		URL:    input.URL,
+		Secret: input.Secret,
+		Events: input.Events,
+		Active: input.Active == nil || *input.Active,
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.auditChange(r, "webhook:"+webhook.ID.String(), nil, webhook)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/webhooks/%s", webhook.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ListWebhooksHandler for the 'Get /v1/admin/webhooks' endpoint.
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.store.Webhooks.GetAll(app.requestTenant(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ShowWebhookHandler for the 'Get /v1/admin/webhooks/:id' endpoint.
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// UpdateWebhookHandler for the 'Patch /v1/admin/webhooks/:id' endpoint. Only the
+// fields present in the request body are changed.
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookFromParam(w, r)
+	if !ok {
+		return
+	}
+	before := *webhook
+
+	var input struct {
+		URL    *string  `json:"url"`
+		Secret *string  `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Secret != nil {
+		webhook.Secret = *input.Secret
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Webhooks.Update(webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "webhook:"+webhook.ID.String(), before, webhook)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DeleteWebhookHandler for the 'Delete /v1/admin/webhooks/:id' endpoint.
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	webhook, err := app.store.Webhooks.Delete(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditChange(r, "webhook:"+webhook.ID.String(), webhook, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ListWebhookDeliveriesHandler for the 'Get /v1/admin/webhooks/:id/deliveries' endpoint.
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries := app.store.Webhooks.Deliveries(webhook.ID)
+	err := app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ListWebhookDeadLettersHandler for the 'Get /v1/admin/webhooks/:id/dead-letters' endpoint.
+func (app *application) listWebhookDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	deadLetters := app.store.Webhooks.DeadLetters(webhook.ID)
+	err := app.writeJSON(w, http.StatusOK, envelope{"deadLetters": deadLetters}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// webhookFromParam() looks up the webhook named by the "id" URL parameter, writing a
+// 404 or 500 response and returning false when it can't.
+func (app *application) webhookFromParam(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.realIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	webhook, err := app.store.Webhooks.Get(app.requestTenant(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return webhook, true
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "webhook-test-secret"
+
+// newTestDispatcher() returns a started dispatcher with a short backoff, delivering with
+// the receiver's client so that the loopback test server can be reached.
+func newTestDispatcher(t *testing.T, srv *httptest.Server) (*webhookDispatcher, data.WebhookModel) {
+	t.Helper()
+
+	stores, err := data.NewStores(data.Categorizers{}, data.Quotas{}, data.ExpirationPolicies{}, data.Tiers{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newWebhookDispatcher(stores.Webhooks, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.backoff = time.Millisecond
+	if srv != nil {
+		d.client = srv.Client()
+	}
+	d.start()
+
+	return d, stores.Webhooks
+}
+
+func insertTestWebhook(t *testing.T, store data.WebhookModel, tenant, url string) *data.Webhook {
+	t.Helper()
+
+	webhook := &data.Webhook{
+		Tenant: tenant,
+		URL:    url,
+		Secret: testWebhookSecret,
+		Events: []string{data.EventReceiptProcessed},
+		Active: true,
+	}
+	err := store.Insert(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return webhook
+}
+
+func shutdownDispatcher(t *testing.T, d *webhookDispatcher) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := d.shutdown(ctx)
+	if err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{header: r.Header.Clone(), body: body}
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, srv)
+	webhook := insertTestWebhook(t, store, "acme", srv.URL)
+
+	d.dispatch("acme", data.EventReceiptProcessed, map[string]string{"retailer": "Target"})
+	shutdownDispatcher(t, d)
+
+	req := <-requests
+	if got := req.header.Get("X-Webhook-Event"); got != data.EventReceiptProcessed {
+		t.Errorf("X-Webhook-Event = %q; want %q", got, data.EventReceiptProcessed)
+	}
+
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(req.header.Get("X-Webhook-Timestamp") + "."))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get("X-Webhook-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("X-Webhook-Signature = %q; want %q", got, want)
+	}
+
+	deliveries := store.Deliveries(webhook.ID)
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries; want 1", len(deliveries))
+	}
+	if got := deliveries[0]; got.Status != data.DeliveryDelivered || got.Attempts != 1 || got.ResponseStatus != http.StatusOK {
+		t.Errorf("delivery = %+v; want delivered on the first attempt with status 200", got)
+	}
+	if got := deliveries[0].ID.String(); got != req.header.Get("X-Webhook-Delivery") {
+		t.Errorf("delivery id = %q; want %q", got, req.header.Get("X-Webhook-Delivery"))
+	}
+}
+
+// Deliveries to a receiver that answers straight away may finish before dispatch()
+// returns, and must still end up delivered rather than pending.
+func TestWebhookImmediateDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, srv)
+	webhook := insertTestWebhook(t, store, "acme", srv.URL)
+
+	const events = 50
+	for range events {
+		d.dispatch("acme", data.EventReceiptProcessed, nil)
+	}
+	shutdownDispatcher(t, d)
+
+	deliveries := store.Deliveries(webhook.ID)
+	if len(deliveries) != events {
+		t.Fatalf("got %d deliveries; want %d", len(deliveries), events)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status != data.DeliveryDelivered {
+			t.Errorf("delivery = %+v; want delivered", delivery)
+		}
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var attempts atomic.Int32
+	times := make(chan time.Time, 3)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times <- time.Now()
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, srv)
+	d.backoff = 20 * time.Millisecond
+	webhook := insertTestWebhook(t, store, "acme", srv.URL)
+
+	d.dispatch("acme", data.EventReceiptProcessed, nil)
+	shutdownDispatcher(t, d)
+
+	if got := attempts.Load(); got != 3 {
+		t.Fatalf("got %d attempts; want 3", got)
+	}
+	first, second, third := <-times, <-times, <-times
+	if wait := second.Sub(first); wait < d.backoff {
+		t.Errorf("first retry after %v; want at least %v", wait, d.backoff)
+	}
+	if wait := third.Sub(second); wait < 2*d.backoff {
+		t.Errorf("second retry after %v; want at least %v", wait, 2*d.backoff)
+	}
+
+	deliveries := store.Deliveries(webhook.ID)
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries; want 1", len(deliveries))
+	}
+	if got := deliveries[0]; got.Status != data.DeliveryDelivered || got.Attempts != 3 || got.Error != "" {
+		t.Errorf("delivery = %+v; want delivered after 3 attempts", got)
+	}
+	if dead := store.DeadLetters(webhook.ID); len(dead) != 0 {
+		t.Errorf("got %d dead letters; want 0", len(dead))
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, srv)
+	webhook := insertTestWebhook(t, store, "acme", srv.URL)
+
+	d.dispatch("acme", data.EventReceiptProcessed, nil)
+	shutdownDispatcher(t, d)
+
+	if got := attempts.Load(); got != webhookMaxAttempts {
+		t.Errorf("got %d attempts; want %d", got, webhookMaxAttempts)
+	}
+
+	dead := store.DeadLetters(webhook.ID)
+	if len(dead) != 1 {
+		t.Fatalf("got %d dead letters; want 1", len(dead))
+	}
+	got := dead[0]
+	if got.Status != data.DeliveryDead || got.Attempts != webhookMaxAttempts || got.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("dead letter = %+v; want dead after %d attempts with status 500", got, webhookMaxAttempts)
+	}
+	if deliveries := store.Deliveries(webhook.ID); len(deliveries) != 1 || deliveries[0].Status != data.DeliveryDead {
+		t.Errorf("delivery log = %+v; want the one dead delivery", deliveries)
+	}
+}
+
+// A webhook that keeps failing must not hold up the deliveries of other webhooks while
+// its retries wait, and the retries still waiting on shutdown are dead-lettered.
+func TestWebhookRetriesDontBlockWorkers(t *testing.T) {
+	delivered := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/dead") {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		close(delivered)
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, srv)
+	d.backoff = time.Hour
+	deadHook := insertTestWebhook(t, store, "acme", srv.URL+"/dead")
+	insertTestWebhook(t, store, "globex", srv.URL+"/live")
+
+	for range 2 * webhookWorkers {
+		d.dispatch("acme", data.EventReceiptProcessed, nil)
+	}
+	d.dispatch("globex", data.EventReceiptProcessed, nil)
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery to the live webhook was held up by the dead one")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := d.shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown: got %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	dead := store.DeadLetters(deadHook.ID)
+	if len(dead) != 2*webhookWorkers {
+		t.Fatalf("got %d dead letters; want %d", len(dead), 2*webhookWorkers)
+	}
+	for _, delivery := range dead {
+		if delivery.Attempts != 1 || !strings.HasPrefix(delivery.Error, "shut down before delivery succeeded") {
+			t.Errorf("dead letter = %+v; want dead-lettered on shutdown after 1 attempt", delivery)
+		}
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(t, nil)
+	webhook := insertTestWebhook(t, store, "acme", srv.URL)
+
+	d.dispatch("acme", data.EventReceiptProcessed, nil)
+	shutdownDispatcher(t, d)
+
+	if got := attempts.Load(); got != 0 {
+		t.Errorf("loopback receiver got %d requests; want 0", got)
+	}
+	dead := store.DeadLetters(webhook.ID)
+	if len(dead) != 1 || !strings.Contains(dead[0].Error, "is not allowed") {
+		t.Errorf("dead letters = %+v; want the delivery refused as not allowed", dead)
+	}
+}
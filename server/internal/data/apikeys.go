@@ -0,0 +1,160 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ScopeReceiptsWrite = "receipts:write"
+	ScopeReceiptsRead  = "receipts:read"
+	ScopeAdmin         = "admin"
+
+	// Prefix of every API key token, so leaked keys are easy to spot.
+	apiKeyTokenPrefix = "rpk_"
+)
+
+var APIKeyScopes = []string{ScopeReceiptsWrite, ScopeReceiptsRead, ScopeAdmin}
+
+// APIKey is a credential presented in the X-API-Key header. Only the SHA-256 hash of the
+// token is kept, the plaintext is returned once when the key is created.
+type APIKey struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Tenant    string    `json:"tenant"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	Scopes    []string  `json:"scopes"`
+}
+
+// HasScope reports whether scopes grant scope. The admin scope grants every scope.
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope) || slices.Contains(scopes, ScopeAdmin)
+}
+
+// GenerateAPIKeyToken returns a new random API key token along with its hash.
+func GenerateAPIKeyToken() (token, hash string, err error) {
+	b := make([]byte, 20)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = apiKeyTokenPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return token, HashAPIKeyToken(token), nil
+}
+
+// HashAPIKeyToken returns the hex-encoded SHA-256 hash under which a token is stored.
+// Tokens are long and random, so a fast unsalted hash is enough.
+func HashAPIKeyToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	ValidateTenant(v, key.Tenant)
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	for _, scope := range key.Scopes {
+		v.Check(validator.PermittedValue(scope, APIKeyScopes...), "scopes", "must only contain receipts:write, receipts:read or admin")
+	}
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+}
+
+func ValidateAPIKeyHash(v *validator.Validator, hash string) {
+	_, err := hex.DecodeString(hash)
+	v.Check(err == nil && len(hash) == 2*sha256.Size, "hash", "must be a hex-encoded SHA-256 hash")
+}
+
+type APIKeyModel struct {
+	Store  map[string]APIKey
+	byHash map[string]uuid.UUID
+	mu     *sync.RWMutex
+}
+
+// Insert stores a key whose Hash has already been set.
+func (m APIKeyModel) Insert(key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now()
+
+	m.Store[key.ID.String()] = *key
+	m.byHash[key.Hash] = key.ID
+	return nil
+}
+
+func (m APIKeyModel) GetAll(tenant string) ([]*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(m.Store))
+	for _, key := range m.Store {
+		if key.Tenant == tenant {
+			keys = append(keys, &key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b *APIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (m APIKeyModel) Get(tenant string, id uuid.UUID) (*APIKey, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, exists := m.Store[id.String()]
+	if !exists || key.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	return &key, nil
+}
+
+// GetForToken returns the key a plaintext token belongs to.
+func (m APIKeyModel) GetForToken(token string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, exists := m.byHash[HashAPIKeyToken(token)]
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+
+	key := m.Store[id.String()]
+	return &key, nil
+}
+
+// Delete revokes a key and returns it as it was stored.
+func (m APIKeyModel) Delete(tenant string, id uuid.UUID) (*APIKey, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, exists := m.Store[id.String()]
+	if !exists || key.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	delete(m.Store, id.String())
+	delete(m.byHash, key.Hash)
+	return &key, nil
+}
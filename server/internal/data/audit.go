@@ -0,0 +1,342 @@
+package data
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one mutating request: who made it on behalf of which tenant, what
+// it changed and how it ended. Before and After are hashes of the changed resource's
+// state, so a change can be matched against a copy of the data without the audit log
+// holding the data itself. Every entry's Hash covers its fields and the Hash of the
+// entry before it, chaining the log so that editing or removing an entry is detectable.
+type AuditEntry struct {
+	Seq       int64     `json:"seq"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	Tenant    string    `json:"tenant"`
+	RequestID string    `json:"requestId"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Resource  string    `json:"resource,omitempty"`
+	Before    string    `json:"before,omitempty"`
+	After     string    `json:"after,omitempty"`
+	PrevHash  string    `json:"prevHash"`
+	Hash      string    `json:"hash"`
+}
+
+// hash returns the hash of the entry chained to the hash of the entry before it.
+func (e AuditEntry) hash() string {
+	e.Hash = ""
+	line, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash), line...))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditHash returns the hash of a resource's state recorded in an AuditEntry, or an
+// empty string when there is no state (before a create, after a delete).
+func AuditHash(state any) string {
+	if state == nil {
+		return ""
+	}
+	line, err := json.Marshal(state)
+	if err != nil || string(line) == "null" {
+		return ""
+	}
+
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+type AuditFilters struct {
+	Actor    string
+	Resource string
+	After    int64
+	Limit    int
+}
+
+func ValidateAuditFilters(v *validator.Validator, f AuditFilters) {
+	v.Check(f.After >= 0, "after", "must not be negative")
+	v.Check(f.Limit > 0, "limit", "must be greater than zero")
+	v.Check(f.Limit <= 1000, "limit", "must be a maximum of 1000")
+}
+
+// AuditVerification reports whether the hash chain of an audit log is intact and, if
+// not, the first entry that doesn't match.
+type AuditVerification struct {
+	Valid    bool  `json:"valid"`
+	Entries  int64 `json:"entries,omitempty"`
+	BrokenAt int64 `json:"brokenAt,omitempty"`
+}
+
+// Number of entries a log without a file keeps in memory. Older entries are dropped.
+const auditMemoryLimit = 10000
+
+// auditIndex locates one entry in the audit log file.
+type auditIndex struct {
+	seq    int64
+	offset int64
+	length int
+}
+
+// AuditLog is the append-only, hash-chained log of mutating requests. When the log was
+// opened with a file, entries are appended to it as NDJSON and synced to disk before
+// Append returns, and only the position of each entry is kept in memory; entries are
+// read back from the file a page at a time. Without a file the most recent
+// auditMemoryLimit entries are kept in memory.
+//
+// The chain is verified once when the log is opened, and after that Verify only checks
+// the entries appended since it last ran.
+type AuditLog struct {
+	file      *os.File
+	size      int64
+	truncated int64
+	tenants   map[string][]auditIndex
+	entries   []AuditEntry
+
+	lastSeq  int64
+	lastHash string
+
+	verifiedSeq    int64
+	verifiedHash   string
+	verifiedOffset int64
+	brokenAt       int64
+
+	mu *sync.RWMutex
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{tenants: make(map[string][]auditIndex), mu: &sync.RWMutex{}}
+}
+
+// OpenAuditLog opens the audit log file at path, creating it if it doesn't exist,
+// indexes the entries already in it and verifies their hash chain, see Verify. A final
+// line without a newline is an append cut short by a crash, which Append never
+// acknowledged, and it is truncated away.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewAuditLog()
+	l.file = file
+
+	r := bufio.NewReader(file)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+		if errors.Is(err, io.EOF) {
+			err = file.Truncate(l.size)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("audit log %s: %w", path, err)
+			}
+			l.truncated = int64(len(line))
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("audit log %s: %w", path, err)
+		}
+
+		var e AuditEntry
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("audit log %s: entry %d: %w", path, n, err)
+		}
+
+		l.index(e, l.size, len(line))
+		l.size += int64(len(line))
+	}
+
+	l.Verify()
+	return l, nil
+}
+
+// Truncated returns the number of bytes of a torn final line OpenAuditLog dropped.
+func (l *AuditLog) Truncated() int64 {
+	return l.truncated
+}
+
+// index() records a new last entry of the log, found at offset in the file. The caller
+// must hold the lock.
+func (l *AuditLog) index(e AuditEntry, offset int64, length int) {
+	l.tenants[e.Tenant] = append(l.tenants[e.Tenant], auditIndex{seq: e.Seq, offset: offset, length: length})
+	l.lastSeq = e.Seq
+	l.lastHash = e.Hash
+}
+
+// read() reads the entry at idx from the file.
+func (l *AuditLog) read(idx auditIndex) (AuditEntry, error) {
+	line := make([]byte, idx.length)
+	_, err := l.file.ReadAt(line, idx.offset)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	var e AuditEntry
+	err = json.Unmarshal(line, &e)
+	return e, err
+}
+
+// Append chains the entry to the last one, assigning its Seq, PrevHash and Hash, and
+// adds it to the log. When writing to the file fails the file is cut back to where it
+// was.
+func (l *AuditLog) Append(e *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.lastSeq + 1
+	e.PrevHash = l.lastHash
+	e.Hash = e.hash()
+
+	if l.file == nil {
+		l.entries = append(l.entries, *e)
+		if len(l.entries) >= 2*auditMemoryLimit {
+			l.entries = slices.Clone(l.entries[len(l.entries)-auditMemoryLimit:])
+		}
+		l.lastSeq = e.Seq
+		l.lastHash = e.Hash
+		return nil
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	_, err = l.file.Write(line)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		return errors.Join(err, l.file.Truncate(l.size))
+	}
+
+	l.index(*e, l.size, len(line))
+	l.size += int64(len(line))
+	return nil
+}
+
+// GetAll returns the tenant's entries matching the filters in log order, starting
+// after the entry with sequence number filters.After.
+func (l *AuditLog) GetAll(tenant string, filters AuditFilters) ([]*AuditEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := []*AuditEntry{}
+	match := func(e AuditEntry) bool {
+		return (filters.Actor == "" || e.Actor == filters.Actor) && (filters.Resource == "" || e.Resource == filters.Resource)
+	}
+
+	if l.file == nil {
+		for _, e := range l.entries {
+			if len(entries) == filters.Limit {
+				break
+			}
+			if e.Seq > filters.After && e.Tenant == tenant && match(e) {
+				entries = append(entries, &e)
+			}
+		}
+		return entries, nil
+	}
+
+	index := l.tenants[tenant]
+	i, _ := slices.BinarySearchFunc(index, filters.After+1, func(idx auditIndex, seq int64) int {
+		return cmp.Compare(idx.seq, seq)
+	})
+	for _, idx := range index[i:] {
+		if len(entries) == filters.Limit {
+			break
+		}
+		e, err := l.read(idx)
+		if err != nil {
+			return nil, err
+		}
+		if match(e) {
+			entries = append(entries, &e)
+		}
+	}
+
+	return entries, nil
+}
+
+// Verify checks the hash chain of the entries appended since the last verification,
+// continuing from the last entry found intact. Once the chain is broken it stays
+// broken, and the first entry that didn't match is reported.
+func (l *AuditLog) Verify() AuditVerification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.brokenAt == 0 {
+		l.brokenAt = l.verify()
+	}
+
+	return AuditVerification{Valid: l.brokenAt == 0, Entries: l.lastSeq, BrokenAt: l.brokenAt}
+}
+
+// verify() checks the entries after the last verified one, returning the sequence
+// number of the first that doesn't match or 0. The caller must hold the lock.
+func (l *AuditLog) verify() int64 {
+	check := func(e AuditEntry) bool {
+		if e.Seq != l.verifiedSeq+1 || e.PrevHash != l.verifiedHash || e.Hash != e.hash() {
+			return false
+		}
+		l.verifiedSeq = e.Seq
+		l.verifiedHash = e.Hash
+		return true
+	}
+
+	if l.file == nil {
+		for _, e := range l.entries {
+			if e.Seq <= l.verifiedSeq {
+				continue
+			}
+			// Entries dropped from memory before they were verified can't be checked,
+			// so the chain is checked from the oldest entry still kept.
+			if l.verifiedSeq < e.Seq-1 {
+				l.verifiedSeq, l.verifiedHash = e.Seq-1, e.PrevHash
+			}
+			if !check(e) {
+				return l.verifiedSeq + 1
+			}
+		}
+		return 0
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(l.file, l.verifiedOffset, l.size-l.verifiedOffset))
+	for l.verifiedOffset < l.size {
+		line, err := r.ReadBytes('\n')
+		var e AuditEntry
+		if err != nil || json.Unmarshal(line, &e) != nil || !check(e) {
+			return l.verifiedSeq + 1
+		}
+		l.verifiedOffset += int64(len(line))
+	}
+	return 0
+}
+
+// Close closes the underlying file, if any.
+func (l *AuditLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendAuditEntries(t *testing.T, l *AuditLog, actors ...string) {
+	t.Helper()
+
+	for _, actor := range actors {
+		err := l.Append(&AuditEntry{Actor: actor, Tenant: DefaultTenant, Method: "POST", Path: "/v1/receipts/process", Status: 201})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAuditLogVerify(t *testing.T) {
+	l := NewAuditLog()
+	appendAuditEntries(t, l, "alice", "bob", "carol")
+
+	// The entries are tampered with before the first verification, since verified
+	// entries aren't checked again.
+	tampered := NewAuditLog()
+	appendAuditEntries(t, tampered, "alice", "bob", "carol")
+	tampered.entries[1].Actor = "mallory"
+
+	tests := []struct {
+		name string
+		log  *AuditLog
+		want AuditVerification
+	}{
+		{name: "intact", log: l, want: AuditVerification{Valid: true, Entries: 3}},
+		{name: "tampered", log: tampered, want: AuditVerification{Valid: false, Entries: 3, BrokenAt: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.log.Verify(); got != tt.want {
+				t.Errorf("Verify() = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Entries appended after a verification are chained to the verified ones.
+	appendAuditEntries(t, l, "dave")
+	if got, want := l.Verify(), (AuditVerification{Valid: true, Entries: 4}); got != want {
+		t.Errorf("Verify() after append = %+v; want %+v", got, want)
+	}
+}
+
+func TestAuditLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendAuditEntries(t, l, "alice", "bob", "carol")
+	l.Close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("torn final line", func(t *testing.T) {
+		line := `{"seq":4,"actor":"da`
+		torn := filepath.Join(t.TempDir(), "audit.log")
+		err := os.WriteFile(torn, append(bytes.Clone(content), line...), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := OpenAuditLog(torn)
+		if err != nil {
+			t.Fatalf("OpenAuditLog() error = %v; want the torn line truncated", err)
+		}
+		defer l.Close()
+
+		if got := l.Truncated(); got != int64(len(line)) {
+			t.Errorf("Truncated() = %d; want %d", got, len(line))
+		}
+		appendAuditEntries(t, l, "dave")
+		if got, want := l.Verify(), (AuditVerification{Valid: true, Entries: 4}); got != want {
+			t.Errorf("Verify() = %+v; want %+v", got, want)
+		}
+	})
+
+	t.Run("tampered entry", func(t *testing.T) {
+		tampered := filepath.Join(t.TempDir(), "audit.log")
+		err := os.WriteFile(tampered, bytes.Replace(content, []byte(`"actor":"bob"`), []byte(`"actor":"eve"`), 1), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := OpenAuditLog(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		if got, want := l.Verify(), (AuditVerification{Valid: false, Entries: 3, BrokenAt: 2}); got != want {
+			t.Errorf("Verify() = %+v; want %+v", got, want)
+		}
+	})
+}
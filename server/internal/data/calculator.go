@@ -28,8 +28,31 @@ const (
 	TimeRangeValue                 = 10
 )
 
+// Rules recorded in a receipt's points breakdown.
+const (
+	RuleRetailerName     = "retailerName"
+	RuleRoundDollar      = "roundDollar"
+	RuleQuarterMultiple  = "quarterMultiple"
+	RuleItemPairs        = "itemPairs"
+	RuleItemDescriptions = "itemDescriptions"
+	RuleOddDay           = "oddDay"
+	RulePurchaseTime     = "purchaseTime"
+	RuleCampaigns        = "campaigns"
+	RuleTier             = "tier"
+)
+
+// PointsLine is the points one rule contributed to a receipt. Tier lines also record
+// the tier and the multiplier that was applied.
+type PointsLine struct {
+	Rule       string           `json:"rule"`
+	Points     int32            `json:"points"`
+	Tier       string           `json:"tier,omitempty"`
+	Multiplier *decimal.Decimal `json:"multiplier,omitempty"`
+}
+
 type Calculator struct {
 	Points int32
+	Lines  []PointsLine
 }
 
 func New() *Calculator {
@@ -42,6 +65,21 @@ func (c *Calculator) AddPoints(points int32) {
 	c.Points += points
 }
 
+// AddRule adds the points of a rule, recording them in the breakdown unless there are
+// none.
+func (c *Calculator) AddRule(rule string, points int32) {
+	c.AddLine(PointsLine{Rule: rule, Points: points})
+}
+
+// AddLine adds a line to the breakdown along with its points. Lines without points are
+// only recorded for tiers, so the tier a receipt was scored in is always known.
+func (c *Calculator) AddLine(line PointsLine) {
+	if line.Points != 0 || line.Rule == RuleTier {
+		c.Lines = append(c.Lines, line)
+	}
+	c.AddPoints(line.Points)
+}
+
 func (c *Calculator) TotalPoints() int32 {
 	return c.Points
 }
@@ -134,3 +172,32 @@ func PurchaseTimeRangePoints(purchaseTime, timeLayout string) int32 {
 
 	return ZeroValue
 }
+
+func CampaignPoints(campaigns []*Campaign, receipt *Receipt, basePoints int32) int32 {
+	var points int32
+
+	for _, campaign := range campaigns {
+		if !campaign.Applies(receipt) {
+			continue
+		}
+
+		matched := campaign.MatchingItems(receipt.Items)
+		if campaign.Targeted() && len(matched) == ZeroValue {
+			continue
+		}
+
+		value := campaign.Bonus.Value
+		switch campaign.Bonus.Type {
+		case BonusFlat:
+			points += int32(value.Round(ZeroValue).IntPart())
+		case BonusMultiplier:
+			bonus := decimal.NewFromInt32(basePoints).Mul(value.Sub(decimal.NewFromInt(int64(DecimalValue))))
+			points += int32(bonus.Round(ZeroValue).IntPart())
+		case BonusPerItem:
+			bonus := value.Mul(decimal.NewFromInt(int64(len(matched))))
+			points += int32(bonus.Round(ZeroValue).IntPart())
+		}
+	}
+
+	return points
+}
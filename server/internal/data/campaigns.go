@@ -0,0 +1,246 @@
+package data
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MatcherSubstring = "substring"
+	MatcherRegex     = "regex"
+
+	BonusFlat       = "flat"
+	BonusMultiplier = "multiplier"
+	BonusPerItem    = "per_item"
+)
+
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// Matcher matches a string either by case-insensitive substring or by regular expression.
+type Matcher struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	rx    *regexp.Regexp
+}
+
+// Bonus describes the points a campaign awards on top of the base rules.
+type Bonus struct {
+	Type  string          `json:"type"`
+	Value decimal.Decimal `json:"value"`
+}
+
+type Campaign struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"-"`
+	Tenant     string     `json:"tenant"`
+	Name       string     `json:"name"`
+	StartDate  string     `json:"startDate"`
+	EndDate    string     `json:"endDate"`
+	Weekdays   []string   `json:"weekdays,omitempty"`
+	RetailerID *uuid.UUID `json:"retailerId,omitempty"`
+	Retailer   *Matcher   `json:"retailer,omitempty"`
+	Item       *Matcher   `json:"item,omitempty"`
+	Category   string     `json:"category,omitempty"`
+	Bonus      Bonus      `json:"bonus"`
+	Version    int32      `json:"version"`
+}
+
+func (m *Matcher) compile() error {
+	if m.Type != MatcherRegex {
+		return nil
+	}
+
+	rx, err := regexp.Compile(m.Value)
+	if err != nil {
+		return err
+	}
+	m.rx = rx
+
+	return nil
+}
+
+func (m *Matcher) Match(value string) bool {
+	if m.Type == MatcherRegex {
+		if m.rx == nil && m.compile() != nil {
+			return false
+		}
+		return m.rx.MatchString(value)
+	}
+
+	return strings.Contains(strings.ToLower(value), strings.ToLower(m.Value))
+}
+
+func ValidateMatcher(v *validator.Validator, m *Matcher, key string) {
+	if m == nil {
+		return
+	}
+	v.Check(validator.PermittedValue(m.Type, MatcherSubstring, MatcherRegex), key+".type", "must be substring or regex")
+	v.Check(m.Value != "", key+".value", "must be provided")
+	v.Check(m.compile() == nil, key+".value", "must be a valid regular expression")
+}
+
+func ValidateCampaign(v *validator.Validator, campaign *Campaign) {
+	v.Check(campaign.Name != "", "name", "must be provided")
+	v.Check(len(campaign.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(validator.TimeFormat(campaign.StartDate, "2006-01-02"), "startDate", "must be in the format YYYY-MM-DD")
+	v.Check(validator.TimeFormat(campaign.EndDate, "2006-01-02"), "endDate", "must be in the format YYYY-MM-DD")
+	v.Check(campaign.EndDate >= campaign.StartDate, "endDate", "must not be before startDate")
+	for _, day := range campaign.Weekdays {
+		v.Check(validator.PermittedValue(strings.ToLower(day), weekdays...), "weekdays", "must only contain days of the week")
+	}
+	v.Check(validator.Unique(campaign.Weekdays), "weekdays", "must not contain duplicate values")
+	ValidateMatcher(v, campaign.Retailer, "retailer")
+	ValidateMatcher(v, campaign.Item, "item")
+	v.Check(len(campaign.Category) <= 100, "category", "must not be more than 100 bytes long")
+	v.Check(validator.PermittedValue(campaign.Bonus.Type, BonusFlat, BonusMultiplier, BonusPerItem), "bonus.type", "must be flat, multiplier or per_item")
+	v.Check(campaign.Bonus.Value.IsPositive(), "bonus.value", "must be positive")
+	if campaign.Bonus.Type == BonusMultiplier {
+		// A multiplier below 1 would take points away instead of awarding a bonus.
+		v.Check(campaign.Bonus.Value.GreaterThanOrEqual(decimal.NewFromInt(1)), "bonus.value", "must be at least 1 for a multiplier")
+	}
+}
+
+// Applies reports whether the receipt falls inside the campaign's date window and
+// matches its weekday and retailer constraints. Retailer constraints key off the
+// canonical catalog retailer when the receipt was normalized to one.
+func (c *Campaign) Applies(receipt *Receipt) bool {
+	if receipt.PurchaseDate < c.StartDate || receipt.PurchaseDate > c.EndDate {
+		return false
+	}
+
+	if len(c.Weekdays) > 0 {
+		parsedDate, err := time.Parse("2006-01-02", receipt.PurchaseDate)
+		if err != nil {
+			return false
+		}
+		day := strings.ToLower(parsedDate.Weekday().String())
+		if !slices.ContainsFunc(c.Weekdays, func(d string) bool { return strings.EqualFold(d, day) }) {
+			return false
+		}
+	}
+
+	if c.RetailerID != nil && (receipt.RetailerID == nil || *receipt.RetailerID != *c.RetailerID) {
+		return false
+	}
+
+	if c.Retailer != nil && !c.Retailer.Match(receipt.CanonicalRetailer()) && !c.Retailer.Match(receipt.Retailer) {
+		return false
+	}
+
+	return true
+}
+
+// Targeted reports whether the campaign only applies to some items of a receipt.
+func (c *Campaign) Targeted() bool {
+	return c.Item != nil || c.Category != ""
+}
+
+// MatchingItems returns the receipt items the campaign's item matcher and category
+// select, or all items when the campaign isn't targeted at particular items.
+func (c *Campaign) MatchingItems(items []Item) []Item {
+	if !c.Targeted() {
+		return items
+	}
+
+	var matched []Item
+	for _, item := range items {
+		if c.Item != nil && !c.Item.Match(strings.TrimSpace(item.ShortDescription)) {
+			continue
+		}
+		if c.Category != "" && !strings.EqualFold(c.Category, item.Category) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+
+	return matched
+}
+
+type CampaignModel struct {
+	Store map[string]Campaign
+	mu    *sync.RWMutex
+}
+
+func (m CampaignModel) Insert(campaign *Campaign) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	campaign.ID = uuid.New()
+	campaign.CreatedAt = time.Now()
+	campaign.Version = 1
+
+	m.Store[campaign.ID.String()] = *campaign
+	return nil
+}
+
+func (m CampaignModel) GetAll(tenant string) ([]*Campaign, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	campaigns := make([]*Campaign, 0, len(m.Store))
+	for _, campaign := range m.Store {
+		if campaign.Tenant == tenant {
+			campaigns = append(campaigns, &campaign)
+		}
+	}
+	slices.SortFunc(campaigns, func(a, b *Campaign) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return campaigns, nil
+}
+
+func (m CampaignModel) Get(tenant string, id uuid.UUID) (*Campaign, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	campaign, exists := m.Store[id.String()]
+	if !exists || campaign.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	return &campaign, nil
+}
+
+func (m CampaignModel) Update(campaign *Campaign) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, exists := m.Store[campaign.ID.String()]
+	if !exists || stored.Tenant != campaign.Tenant {
+		return ErrRecordNotFound
+	}
+	if stored.Version != campaign.Version {
+		return ErrEditConflict
+	}
+
+	campaign.Version += 1
+	m.Store[campaign.ID.String()] = *campaign
+	return nil
+}
+
+// Delete removes a campaign and returns it as it was stored.
+func (m CampaignModel) Delete(tenant string, id uuid.UUID) (*Campaign, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	campaign, exists := m.Store[id.String()]
+	if !exists || campaign.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	delete(m.Store, id.String())
+	return &campaign, nil
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const Uncategorized = "uncategorized"
+
+// CategoryRule maps item descriptions to a category, either by whole-word keyword or
+// by regular expression. Rules are applied in order and the first match wins.
+type CategoryRule struct {
+	Category string   `json:"category"`
+	Keywords []string `json:"keywords,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+type categoryRule struct {
+	category string
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+type Categorizer struct {
+	rules []categoryRule
+}
+
+func DefaultCategoryRules() []CategoryRule {
+	return []CategoryRule{
+		{Category: "beverages", Keywords: []string{"dew", "pepsi", "coke", "cola", "soda", "water", "dasani", "juice", "coffee", "tea", "gatorade", "sprite", "klarbrunn"}, Patterns: []string{`\b\d+\s*-?\s*fl\s*oz\b`}},
+		{Category: "snacks", Keywords: []string{"doritos", "chips", "cheetos", "pretzels", "cookies", "candy", "popcorn", "crackers"}},
+		{Category: "grocery", Keywords: []string{"pizza", "chicken", "knorr", "bread", "milk", "eggs", "cheese", "pasta", "rice", "cereal"}},
+		{Category: "household", Keywords: []string{"detergent", "paper", "towels", "tissue", "soap", "cleaner", "bleach", "sponge", "trash"}},
+	}
+}
+
+// LoadCategoryRules reads a JSON array of CategoryRule values from the given file.
+func LoadCategoryRules(path string) ([]CategoryRule, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []CategoryRule
+	err = json.Unmarshal(file, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("category rules %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+func NewCategorizer(rules []CategoryRule) (*Categorizer, error) {
+	c := &Categorizer{}
+
+	for _, rule := range rules {
+		if rule.Category == "" {
+			return nil, fmt.Errorf("category rule without a category")
+		}
+
+		compiled := categoryRule{category: strings.ToLower(rule.Category)}
+		for _, keyword := range rule.Keywords {
+			compiled.keywords = append(compiled.keywords, strings.ToLower(keyword))
+		}
+		for _, pattern := range rule.Patterns {
+			rx, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("category %s: %w", rule.Category, err)
+			}
+			compiled.patterns = append(compiled.patterns, rx)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+
+	return c, nil
+}
+
+// Categorize returns the category of the first rule matching the item description, or
+// Uncategorized when no rule matches.
+func (c *Categorizer) Categorize(description string) string {
+	words := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	for _, rule := range c.rules {
+		for _, keyword := range rule.keywords {
+			if slices.Contains(words, keyword) {
+				return rule.category
+			}
+		}
+		for _, rx := range rule.patterns {
+			if rx.MatchString(description) {
+				return rule.category
+			}
+		}
+	}
+
+	return Uncategorized
+}
+
+// Categories returns every category the categorizer can assign, including Uncategorized.
+func (c *Categorizer) Categories() []string {
+	categories := []string{Uncategorized}
+	for _, rule := range c.rules {
+		if !slices.Contains(categories, rule.category) {
+			categories = append(categories, rule.category)
+		}
+	}
+
+	return categories
+}
+
+// Categorizers holds the categorizers of the tenants that have their own category rules,
+// and the default categorizer used by every other tenant.
+type Categorizers struct {
+	Default *Categorizer
+	Tenants map[string]*Categorizer
+}
+
+// For returns the categorizer for the tenant's receipts.
+func (c Categorizers) For(tenant string) *Categorizer {
+	if categorizer, exists := c.Tenants[tenant]; exists {
+		return categorizer
+	}
+
+	return c.Default
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Number of delivery queues per subscriber. Events for the same receipt always use the
+// same queue, so they are delivered in order, while different receipts proceed in
+// parallel.
+const eventShards = 8
+
+// Event is a change to a receipt, or to an account caused by one, published on the
+// EventBus.
+type Event interface {
+	Name() string
+	receiptID() uuid.UUID
+}
+
+type ReceiptCreated struct {
+	Receipt Receipt
+	At      time.Time
+}
+
+type ReceiptUpdated struct {
+	Before Receipt
+	After  Receipt
+	At     time.Time
+}
+
+type ReceiptDeleted struct {
+	Receipt Receipt
+	At      time.Time
+}
+
+type PointsAdjusted struct {
+	ReceiptID uuid.UUID
+	Before    int32
+	After     int32
+	At        time.Time
+}
+
+// TierChanged is published when an account moves to another loyalty tier, either
+// because a receipt changed the points it earned or because older points dropped out of
+// the 12-month window. ReceiptID is uuid.Nil in the latter case.
+type TierChanged struct {
+	Tenant    string
+	AccountID string
+	Before    string
+	After     string
+	ReceiptID uuid.UUID
+	At        time.Time
+}
+
+func (e ReceiptCreated) Name() string         { return "receipt.created" }
+func (e ReceiptCreated) receiptID() uuid.UUID { return e.Receipt.ID }
+func (e ReceiptUpdated) Name() string         { return "receipt.updated" }
+func (e ReceiptUpdated) receiptID() uuid.UUID { return e.After.ID }
+func (e ReceiptDeleted) Name() string         { return "receipt.deleted" }
+func (e ReceiptDeleted) receiptID() uuid.UUID { return e.Receipt.ID }
+func (e PointsAdjusted) Name() string         { return "points.adjusted" }
+func (e PointsAdjusted) receiptID() uuid.UUID { return e.ReceiptID }
+func (e TierChanged) Name() string            { return "account.tier_changed" }
+func (e TierChanged) receiptID() uuid.UUID    { return e.ReceiptID }
+
+type EventHandler func(Event) error
+
+// eventQueue is an unbounded FIFO drained by a single goroutine, so publishing never
+// blocks on a slow subscriber.
+type eventQueue struct {
+	mu     sync.Mutex
+	events []Event
+	wake   chan struct{}
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) pop() (Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.events) == 0 {
+		return nil, false
+	}
+	event := q.events[0]
+	q.events[0] = nil
+	q.events = q.events[1:]
+	return event, true
+}
+
+type subscription struct {
+	name    string
+	handler EventHandler
+	queues  [eventShards]*eventQueue
+}
+
+// EventBus is an in-process publish/subscribe bus for receipt lifecycle events. Each
+// subscriber gets its own queues and goroutines: a subscriber that is slow, returns an
+// error or panics only affects itself, and never the publisher or other subscribers.
+type EventBus struct {
+	mu      sync.RWMutex
+	subs    []*subscription
+	closed  bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	onError func(subscriber string, event Event, err error)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		stop:    make(chan struct{}),
+		onError: func(string, Event, error) {},
+	}
+}
+
+// OnError sets the function called when a subscriber returns an error or panics.
+func (b *EventBus) OnError(fn func(subscriber string, event Event, err error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onError = fn
+}
+
+// Subscribe registers a named handler for every event published from now on.
+func (b *EventBus) Subscribe(name string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{name: name, handler: handler}
+	for i := range sub.queues {
+		q := &eventQueue{wake: make(chan struct{}, 1)}
+		sub.queues[i] = q
+		b.wg.Add(1)
+		go b.run(sub, q)
+	}
+	b.subs = append(b.subs, sub)
+}
+
+// Publish queues the event for every subscriber without waiting for delivery. Events
+// published after Shutdown has started are dropped.
+func (b *EventBus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	h := fnv.New32a()
+	id := event.receiptID()
+	h.Write(id[:])
+	shard := h.Sum32() % eventShards
+
+	for _, sub := range b.subs {
+		sub.queues[shard].push(event)
+	}
+}
+
+func (b *EventBus) run(sub *subscription, q *eventQueue) {
+	defer b.wg.Done()
+
+	for {
+		for {
+			event, ok := q.pop()
+			if !ok {
+				break
+			}
+			b.deliver(sub, event)
+		}
+
+		select {
+		case <-q.wake:
+		case <-b.stop:
+			// Deliver whatever was queued before shutdown, then exit.
+			for {
+				event, ok := q.pop()
+				if !ok {
+					return
+				}
+				b.deliver(sub, event)
+			}
+		}
+	}
+}
+
+func (b *EventBus) deliver(sub *subscription, event Event) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			b.reportError(sub.name, event, fmt.Errorf("subscriber panicked: %v", rec))
+		}
+	}()
+
+	if err := sub.handler(event); err != nil {
+		b.reportError(sub.name, event, err)
+	}
+}
+
+func (b *EventBus) reportError(subscriber string, event Event, err error) {
+	b.mu.RLock()
+	onError := b.onError
+	b.mu.RUnlock()
+
+	onError(subscriber, event, err)
+}
+
+// Shutdown stops accepting events and waits for the subscribers to work through the
+// events already queued, or for the context to be done.
+func (b *EventBus) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
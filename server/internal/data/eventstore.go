@@ -0,0 +1,357 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LoggedEvent is a receipt change as it is persisted in an EventLog. Every event carries
+// the receipt as it was stored after the change (or, for deletions, before it), so
+// replaying the log in order reproduces the receipt store.
+type LoggedEvent struct {
+	Seq     int64     `json:"seq"`
+	Type    string    `json:"type"`
+	At      time.Time `json:"at"`
+	Receipt Receipt   `json:"receipt"`
+}
+
+// EventLog is an append-only NDJSON file of receipt events. Appends are synced to disk
+// before they return, so an event the store acknowledged survives a crash.
+type EventLog struct {
+	path      string
+	file      *os.File
+	seq       int64
+	truncated int64
+	mu        *sync.Mutex
+}
+
+// OpenEventLog opens the event log at path, creating it if it doesn't exist, and
+// checks that the events already in it can be read back. A final line without a
+// newline is an append cut short by a crash; it was never synced, so it was never
+// acknowledged, and it is truncated away.
+func OpenEventLog(path string) (*EventLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &EventLog{path: path, file: file, mu: &sync.Mutex{}}
+	end, err := l.replay(func(e LoggedEvent) error {
+		l.seq = e.Seq
+		return nil
+	})
+	if err == nil {
+		err = l.truncate(end)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Truncated returns the number of bytes of a torn final line OpenEventLog dropped.
+func (l *EventLog) Truncated() int64 {
+	return l.truncated
+}
+
+// truncate() cuts the log file back to size if it is any longer.
+func (l *EventLog) truncate(size int64) error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= size {
+		return nil
+	}
+
+	err = l.file.Truncate(size)
+	if err != nil {
+		return err
+	}
+	l.truncated += info.Size() - size
+	return nil
+}
+
+// Append assigns the next sequence number to the event and writes it to the log.
+func (l *EventLog) Append(e *LoggedEvent) error {
+	return l.AppendBatch([]*LoggedEvent{e})
+}
+
+// AppendBatch assigns the next sequence numbers to the events and writes them to the
+// log at once. When the write fails the log is cut back to where it was, so either all
+// of the events are logged or none of them are.
+func (l *EventLog) AppendBatch(events []*LoggedEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	for i, e := range events {
+		e.Seq = l.seq + int64(i) + 1
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = l.file.Write(buf.Bytes())
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		return errors.Join(err, l.truncate(info.Size()))
+	}
+
+	l.seq += int64(len(events))
+	return nil
+}
+
+// Replay calls fn with every event in the log, oldest first. Appends wait until the
+// replay is done.
+func (l *EventLog) Replay(fn func(LoggedEvent) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.replay(fn)
+	return err
+}
+
+// replay() calls fn with every complete line of the log and returns the offset just
+// past the last one. A final line without a newline is skipped. The caller must hold
+// the lock.
+func (l *EventLog) replay(fn func(LoggedEvent) error) (int64, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var end int64
+	for n := 1; ; {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return end, nil
+		}
+		if err != nil {
+			return end, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			end += int64(len(line))
+			continue
+		}
+
+		var e LoggedEvent
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return end, fmt.Errorf("event log %s: event %d: %w", l.path, n, err)
+		}
+
+		err = fn(e)
+		if err != nil {
+			return end, err
+		}
+		end += int64(len(line))
+		n++
+	}
+}
+
+// Close closes the underlying file.
+func (l *EventLog) Close() error {
+	return l.file.Close()
+}
+
+// applyLogged applies a logged event to a receipt map keyed by id.
+func applyLogged(state map[string]Receipt, e LoggedEvent) error {
+	key := e.Receipt.ID.String()
+
+	switch e.Type {
+	case ReceiptCreated{}.Name():
+		receipt := e.Receipt
+		receipt.CreatedAt = e.At
+		receipt.Tenant = TenantOrDefault(receipt.Tenant)
+		receipt.Status = receiptStatus(&receipt)
+		state[key] = receipt
+	case ReceiptUpdated{}.Name(), PointsAdjusted{}.Name():
+		stored, exists := state[key]
+		if !exists {
+			return fmt.Errorf("event %d: %s for unknown receipt %s", e.Seq, e.Type, key)
+		}
+		receipt := e.Receipt
+		receipt.CreatedAt = stored.CreatedAt
+		receipt.Tenant = stored.Tenant
+		receipt.Status = receiptStatus(&receipt)
+		state[key] = receipt
+	case ReceiptDeleted{}.Name():
+		delete(state, key)
+	default:
+		return fmt.Errorf("event %d: unknown event type %q", e.Seq, e.Type)
+	}
+
+	return nil
+}
+
+// EventSourcedReceiptModel is a receipt store whose source of truth is an EventLog.
+// Inserts, updates and deletes append an event before the in-memory projection they
+// are served from is changed, and the projection is rebuilt from the log on startup.
+type EventSourcedReceiptModel struct {
+	ReceiptModel
+	log *EventLog
+}
+
+func (m EventSourcedReceiptModel) record(e LoggedEvent) error {
+	return m.log.Append(&e)
+}
+
+func (m EventSourcedReceiptModel) Insert(receipt *Receipt) error {
+	return m.insert(receipt, m.record)
+}
+
+func (m EventSourcedReceiptModel) Update(receipt *Receipt) error {
+	return m.update(receipt, m.record)
+}
+
+func (m EventSourcedReceiptModel) Delete(tenant string, id uuid.UUID) (*Receipt, error) {
+	return m.delete(tenant, id, m.record)
+}
+
+// load replays the log into the empty projection exactly as it was recorded and
+// publishes a ReceiptCreated event per receipt, so aggregates subscribed to the bus
+// catch up. Receipts submitted today count against their account's quotas again, and
+// every receipt is credited to its account's ledger.
+func (m EventSourcedReceiptModel) load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.log.Replay(func(e LoggedEvent) error {
+		return applyLogged(m.Store, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, receipt := range m.Store {
+		m.quotas.record(&receipt)
+		m.risk.record(&receipt)
+		m.ledger.record(&receipt)
+		m.events.Publish(ReceiptCreated{Receipt: receipt, At: receipt.CreatedAt})
+	}
+	return nil
+}
+
+// RebuildSummary reports the outcome of a rebuild.
+type RebuildSummary struct {
+	Events   int `json:"events"`
+	Receipts int `json:"receipts"`
+	Rescored int `json:"rescored"`
+}
+
+// Rebuild replays the whole log into a fresh projection and recalculates every
+// receipt's points under the current rules, its tenant's campaigns and the tier it was
+// scored in. Receipts whose points changed
+// get a 'points.adjusted' event in the log, and the regenerated projection replaces the
+// current one. Changes are published on the bus so subscribed aggregates follow. The
+// adjustments are appended to the log in one batch before anything in memory changes,
+// so a failed append leaves both as they were.
+func (m EventSourcedReceiptModel) Rebuild() (RebuildSummary, error) {
+	var summary RebuildSummary
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := make(map[string]Receipt)
+	err := m.log.Replay(func(e LoggedEvent) error {
+		summary.Events++
+		return applyLogged(state, e)
+	})
+	if err != nil {
+		return summary, err
+	}
+	summary.Receipts = len(state)
+
+	campaigns := make(map[string][]*Campaign)
+	now := time.Now()
+	var adjusted []*LoggedEvent
+	for _, receipt := range state {
+		if _, exists := campaigns[receipt.Tenant]; !exists {
+			campaigns[receipt.Tenant], err = m.campaigns.GetAll(receipt.Tenant)
+			if err != nil {
+				return summary, err
+			}
+		}
+
+		// Receipts keep the tier they were scored in, and receipts that weren't approved
+		// keep their points pending.
+		c := New()
+		CalculatePoints(c, &receipt, campaigns[receipt.Tenant])
+		if line := receipt.tierLine(); line != nil {
+			if tier, ok := tierNamed(m.ledger.tiers.For(receipt.Tenant), line.Tier); ok {
+				ApplyTier(c, tier)
+			}
+		}
+		points := c.TotalPoints()
+		current := &receipt.Points
+		if receipt.Status != StatusApproved {
+			current = &receipt.PendingPoints
+		}
+		if points == *current {
+			continue
+		}
+		*current = points
+		receipt.Breakdown = c.Lines
+		receipt.Version += 1
+		adjusted = append(adjusted, &LoggedEvent{Type: PointsAdjusted{}.Name(), At: now, Receipt: receipt})
+	}
+
+	if len(adjusted) > 0 {
+		err = m.log.AppendBatch(adjusted)
+		if err != nil {
+			return summary, err
+		}
+	}
+	for _, e := range adjusted {
+		state[e.Receipt.ID.String()] = e.Receipt
+	}
+	summary.Rescored = len(adjusted)
+
+	for key, receipt := range state {
+		before, exists := m.Store[key]
+		switch {
+		case !exists:
+			m.events.Publish(ReceiptCreated{Receipt: receipt, At: receipt.CreatedAt})
+		case before.Version != receipt.Version:
+			m.events.Publish(ReceiptUpdated{Before: before, After: receipt, At: now})
+			if before.Points != receipt.Points {
+				m.events.Publish(PointsAdjusted{ReceiptID: receipt.ID, Before: before.Points, After: receipt.Points, At: now})
+			}
+		}
+	}
+	for key, receipt := range m.Store {
+		if _, exists := state[key]; !exists {
+			m.events.Publish(ReceiptDeleted{Receipt: receipt, At: now})
+			m.ledger.forget(&receipt)
+		}
+	}
+
+	clear(m.Store)
+	for key, receipt := range state {
+		m.Store[key] = receipt
+		m.ledger.record(&receipt)
+	}
+	return summary, nil
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"strings"
+)
+
+type ReceiptFilters struct {
+	Retailer string
+	From     string
+	To       string
+	Status   string
+}
+
+func ValidateReceiptFilters(v *validator.Validator, f ReceiptFilters) {
+	v.Check(len(f.Retailer) <= 500, "retailer", "must not be more than 500 bytes long")
+	if f.From != "" {
+		v.Check(validator.TimeFormat(f.From, "2006-01-02"), "from", "must be in the format YYYY-MM-DD")
+	}
+	if f.To != "" {
+		v.Check(validator.TimeFormat(f.To, "2006-01-02"), "to", "must be in the format YYYY-MM-DD")
+	}
+	if f.From != "" && f.To != "" {
+		v.Check(f.From <= f.To, "to", "must not be before from")
+	}
+	if f.Status != "" {
+		v.Check(validator.PermittedValue(f.Status, StatusPending, StatusApproved, StatusRejected), "status", "must be pending, approved or rejected")
+	}
+}
+
+// Match reports whether the receipt's retailer (raw or canonical) and purchase date
+// satisfy the filters, and whether it has the status asked for.
+func (f ReceiptFilters) Match(receipt *Receipt) bool {
+	if f.Status != "" && receipt.Status != f.Status {
+		return false
+	}
+	if f.Retailer != "" && !strings.EqualFold(f.Retailer, receipt.Retailer) && !strings.EqualFold(f.Retailer, receipt.CanonicalRetailer()) {
+		return false
+	}
+	if f.From != "" && receipt.PurchaseDate < f.From {
+		return false
+	}
+	if f.To != "" && receipt.PurchaseDate > f.To {
+		return false
+	}
+
+	return true
+}
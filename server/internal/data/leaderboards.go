@@ -0,0 +1,236 @@
+package data
+
+import (
+	"cmp"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LeaderboardRetailer = "retailer"
+	LeaderboardAccount  = "account"
+
+	WindowAll = "all"
+	day       = 24 * time.Hour
+)
+
+// LeaderboardWindows maps each rolling window to the number of days it covers,
+// including the current day.
+var LeaderboardWindows = map[string]int{
+	"day":   1,
+	"week":  7,
+	"month": 30,
+	"year":  365,
+}
+
+func ValidateLeaderboardQuery(v *validator.Validator, kind, window string, limit int) {
+	v.Check(validator.PermittedValue(kind, LeaderboardRetailer, LeaderboardAccount), "kind", "must be retailer or account")
+	v.Check(window == WindowAll || LeaderboardWindows[window] > 0, "window", "must be day, week, month, year or all")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maximum of 100")
+}
+
+type LeaderboardEntry struct {
+	Rank   int    `json:"rank"`
+	Entity string `json:"entity"`
+	Points int64  `json:"points"`
+}
+
+// rankedSet keeps entities ordered by score (highest first, ties broken by name) so
+// ranks and top-N slices can be read without sorting on every request.
+type rankedSet struct {
+	scores map[string]int64
+	order  []string
+}
+
+func newRankedSet() *rankedSet {
+	return &rankedSet{scores: make(map[string]int64)}
+}
+
+func (s *rankedSet) search(entity string, score int64) (int, bool) {
+	return slices.BinarySearchFunc(s.order, entity, func(e, target string) int {
+		return cmp.Or(cmp.Compare(score, s.scores[e]), strings.Compare(e, target))
+	})
+}
+
+func (s *rankedSet) incr(entity string, delta int64) {
+	if score, exists := s.scores[entity]; exists {
+		i, _ := s.search(entity, score)
+		s.order = slices.Delete(s.order, i, i+1)
+	}
+
+	score := s.scores[entity] + delta
+	if score == 0 {
+		delete(s.scores, entity)
+		return
+	}
+
+	i, _ := s.search(entity, score)
+	s.order = slices.Insert(s.order, i, entity)
+	s.scores[entity] = score
+}
+
+func (s *rankedSet) top(limit int) []*LeaderboardEntry {
+	entries := make([]*LeaderboardEntry, 0, min(limit, len(s.order)))
+	for i, entity := range s.order[:min(limit, len(s.order))] {
+		entries = append(entries, &LeaderboardEntry{Rank: i + 1, Entity: entity, Points: s.scores[entity]})
+	}
+
+	return entries
+}
+
+func (s *rankedSet) rank(entity string) (*LeaderboardEntry, bool) {
+	score, exists := s.scores[entity]
+	if !exists {
+		return nil, false
+	}
+
+	i, _ := s.search(entity, score)
+	return &LeaderboardEntry{Rank: i + 1, Entity: entity, Points: score}, true
+}
+
+// leaderboard holds one ranked set per window. Points are also kept per day so that
+// days sliding out of a rolling window can be subtracted from its set.
+type leaderboard struct {
+	sets    map[string]*rankedSet
+	days    map[time.Time]map[string]int64
+	current time.Time
+}
+
+func newLeaderboard(now time.Time) *leaderboard {
+	lb := &leaderboard{
+		sets:    map[string]*rankedSet{WindowAll: newRankedSet()},
+		days:    make(map[time.Time]map[string]int64),
+		current: now.UTC().Truncate(day),
+	}
+	for window := range LeaderboardWindows {
+		lb.sets[window] = newRankedSet()
+	}
+
+	return lb
+}
+
+// advance moves the leaderboard forward to the given day, expiring the points of days
+// that have fallen out of each rolling window.
+func (lb *leaderboard) advance(now time.Time) {
+	today := now.UTC().Truncate(day)
+	for lb.current.Before(today) {
+		lb.current = lb.current.Add(day)
+		for window, days := range LeaderboardWindows {
+			expired := lb.current.Add(-time.Duration(days) * day)
+			for entity, points := range lb.days[expired] {
+				lb.sets[window].incr(entity, -points)
+			}
+		}
+	}
+
+	longest := slices.Max(slices.Collect(maps.Values(LeaderboardWindows)))
+	oldest := lb.current.Add(-time.Duration(longest) * day)
+	for date := range lb.days {
+		if !date.After(oldest) {
+			delete(lb.days, date)
+		}
+	}
+}
+
+func (lb *leaderboard) add(entity string, at time.Time, points int64) {
+	date := at.UTC().Truncate(day)
+	lb.sets[WindowAll].incr(entity, points)
+
+	for window, days := range LeaderboardWindows {
+		if date.After(lb.current.Add(-time.Duration(days) * day)) {
+			lb.sets[window].incr(entity, points)
+		}
+	}
+
+	if lb.days[date] == nil {
+		lb.days[date] = make(map[string]int64)
+	}
+	lb.days[date][entity] += points
+}
+
+// LeaderboardModel keeps one leaderboard per tenant and kind. Retailers are ranked by
+// the points of every receipt, accounts only by those of receipts with an account.
+// Like StatsModel it follows the receipts through the EventBus, so reads may briefly
+// lag behind them.
+type LeaderboardModel struct {
+	boards map[string]*leaderboard
+	mu     *sync.Mutex
+}
+
+func boardKey(tenant, kind string) string {
+	return tenant + "/" + kind
+}
+
+func (m LeaderboardModel) apply(receipt *Receipt, sign int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entities := map[string]string{
+		LeaderboardRetailer: receipt.CanonicalRetailer(),
+	}
+	if receipt.AccountID != "" {
+		entities[LeaderboardAccount] = receipt.AccountID
+	}
+
+	for kind, entity := range entities {
+		lb, exists := m.boards[boardKey(receipt.Tenant, kind)]
+		if !exists {
+			lb = newLeaderboard(time.Now())
+			m.boards[boardKey(receipt.Tenant, kind)] = lb
+		}
+		lb.advance(time.Now())
+		lb.add(entity, receipt.CreatedAt, sign*int64(receipt.Points))
+	}
+}
+
+// Add credits a newly stored receipt's points to its entities on every leaderboard.
+func (m LeaderboardModel) Add(receipt *Receipt) {
+	m.apply(receipt, 1)
+}
+
+// Remove takes a previously added receipt's points back off every leaderboard.
+func (m LeaderboardModel) Remove(receipt *Receipt) {
+	m.apply(receipt, -1)
+}
+
+// Get returns the top entries of one of the tenant's leaderboards for the given window,
+// and the rank of the requested entity when one is given and it has points in that
+// window.
+func (m LeaderboardModel) Get(tenant, kind, window string, limit int, entity string) ([]*LeaderboardEntry, *LeaderboardEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lb, exists := m.boards[boardKey(tenant, kind)]
+	if !exists {
+		return []*LeaderboardEntry{}, nil, nil
+	}
+	lb.advance(time.Now())
+
+	set := lb.sets[window]
+	if entity == "" {
+		return set.top(limit), nil, nil
+	}
+
+	ranked, _ := set.rank(entity)
+	return set.top(limit), ranked, nil
+}
+
+// Handle keeps the leaderboards in step with receipt events published on the EventBus.
+func (m LeaderboardModel) Handle(event Event) error {
+	switch e := event.(type) {
+	case ReceiptCreated:
+		m.Add(&e.Receipt)
+	case ReceiptUpdated:
+		m.Remove(&e.Before)
+		m.Add(&e.After)
+	case ReceiptDeleted:
+		m.Remove(&e.Receipt)
+	}
+
+	return nil
+}
@@ -0,0 +1,292 @@
+package data
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// With ExpirationInactivity an account's whole balance expires once it has gone
+	// Months months without earning points. With ExpirationSchedule points expire on the
+	// first day of a month, Months full months after the month they were earned in.
+	ExpirationNone       = "none"
+	ExpirationInactivity = "inactivity"
+	ExpirationSchedule   = "schedule"
+
+	LedgerEarn   = "earn"
+	LedgerExpire = "expire"
+)
+
+// ExpirationPolicy decides when the points of a tenant's accounts expire.
+type ExpirationPolicy struct {
+	Type   string `json:"type"`
+	Months int    `json:"months,omitempty"`
+}
+
+func ValidateExpirationPolicy(v *validator.Validator, p ExpirationPolicy) {
+	v.Check(validator.PermittedValue(p.Type, ExpirationNone, ExpirationInactivity, ExpirationSchedule), "type", "must be none, inactivity or schedule")
+	if p.Type != ExpirationNone {
+		v.Check(p.Months >= 1 && p.Months <= 120, "months", "must be between 1 and 120")
+	}
+}
+
+// ExpirationPolicies holds the policies of the tenants that have their own, and the
+// default policy used by every other tenant.
+type ExpirationPolicies struct {
+	Default ExpirationPolicy
+	Tenants map[string]ExpirationPolicy
+}
+
+// For returns the expiration policy of the tenant's accounts.
+func (p ExpirationPolicies) For(tenant string) ExpirationPolicy {
+	if policy, exists := p.Tenants[tenant]; exists {
+		return policy
+	}
+
+	return p.Default
+}
+
+// LedgerEntry is a change to an account's points balance: the points a receipt earned,
+// or points that expired.
+type LedgerEntry struct {
+	Type      string     `json:"type"`
+	Points    int64      `json:"points"`
+	At        time.Time  `json:"at"`
+	ReceiptID *uuid.UUID `json:"receiptId,omitempty"`
+}
+
+// Expiration is an amount of an account's points that expires at a given time.
+type Expiration struct {
+	Points    int64     `json:"points"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AccountExpirations reports an account's balance and the points it has yet to lose,
+// soonest first.
+type AccountExpirations struct {
+	AccountID string           `json:"accountId"`
+	Balance   int64            `json:"balance"`
+	Policy    ExpirationPolicy `json:"policy"`
+	Upcoming  []*Expiration    `json:"upcoming"`
+}
+
+// accountLedger holds one account's entries. Earned points are kept per receipt so that
+// a receipt whose points change or which is deleted replaces or drops its entry.
+// Tier is the loyalty tier the account was last found to be in.
+type accountLedger struct {
+	earned  map[uuid.UUID]LedgerEntry
+	expired []LedgerEntry
+	tier    string
+}
+
+// earnedSince() returns the points the account earned after since.
+func (l *accountLedger) earnedSince(since time.Time) int64 {
+	var points int64
+	for _, e := range l.earned {
+		if e.At.After(since) {
+			points += e.Points
+		}
+	}
+	return points
+}
+
+// earnings() returns the account's earn entries, oldest first.
+func (l *accountLedger) earnings() []LedgerEntry {
+	entries := slices.Collect(maps.Values(l.earned))
+	slices.SortFunc(entries, func(a, b LedgerEntry) int {
+		return a.At.Compare(b.At)
+	})
+	return entries
+}
+
+// expirations() works out every expiration of the account's points under the policy
+// from its earnings alone, so the result is the same however often it is worked out.
+func (l *accountLedger) expirations(policy ExpirationPolicy) []*Expiration {
+	var expirations []*Expiration
+
+	switch policy.Type {
+	case ExpirationInactivity:
+		var balance int64
+		var last time.Time
+		for _, e := range l.earnings() {
+			if balance > 0 && !e.At.Before(last.AddDate(0, policy.Months, 0)) {
+				expirations = append(expirations, &Expiration{Points: balance, ExpiresAt: last.AddDate(0, policy.Months, 0)})
+				balance = 0
+			}
+			balance += e.Points
+			last = e.At
+		}
+		if balance > 0 {
+			expirations = append(expirations, &Expiration{Points: balance, ExpiresAt: last.AddDate(0, policy.Months, 0)})
+		}
+	case ExpirationSchedule:
+		byDate := make(map[time.Time]int64)
+		for _, e := range l.earned {
+			earned := e.At.UTC()
+			month := time.Date(earned.Year(), earned.Month(), 1, 0, 0, 0, 0, time.UTC)
+			byDate[month.AddDate(0, policy.Months+1, 0)] += e.Points
+		}
+		for _, date := range slices.SortedFunc(maps.Keys(byDate), time.Time.Compare) {
+			expirations = append(expirations, &Expiration{Points: byDate[date], ExpiresAt: date})
+		}
+	}
+
+	return expirations
+}
+
+// written() reports whether an expiry entry was already written for the expiration.
+func (l *accountLedger) written(expiration *Expiration) bool {
+	return slices.ContainsFunc(l.expired, func(e LedgerEntry) bool {
+		return e.At.Equal(expiration.ExpiresAt)
+	})
+}
+
+// LedgerModel is the points ledger of every account. Earn entries follow the stored
+// receipts, and expiry entries are written by Expire under each tenant's
+// ExpirationPolicy. Receipts without an account are not in the ledger. The ledger also
+// places every account in a loyalty tier by the points it earned over the last 12
+// months, and publishes a TierChanged event when an account changes tier.
+type LedgerModel struct {
+	policies ExpirationPolicies
+	tiers    Tiers
+	accounts map[string]*accountLedger
+	events   *EventBus
+	mu       *sync.RWMutex
+}
+
+func ledgerKey(tenant, account string) string {
+	return tenant + "/" + account
+}
+
+// record sets the earn entry of a stored receipt to the points it was awarded. Receipts
+// without points, such as those still pending review, have no entry.
+func (m LedgerModel) record(receipt *Receipt) {
+	if receipt.AccountID == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := ledgerKey(receipt.Tenant, receipt.AccountID)
+	l, exists := m.accounts[key]
+	if !exists {
+		l = &accountLedger{earned: make(map[uuid.UUID]LedgerEntry), tier: m.tiers.For(receipt.Tenant)[0].Name}
+		m.accounts[key] = l
+	}
+
+	id := receipt.ID
+	if receipt.Points > 0 {
+		l.earned[id] = LedgerEntry{Type: LedgerEarn, Points: int64(receipt.Points), At: receipt.CreatedAt, ReceiptID: &id}
+	} else {
+		delete(l.earned, id)
+	}
+	m.retier(l, receipt.Tenant, receipt.AccountID, id, time.Now())
+}
+
+// forget drops the earn entry of a deleted receipt.
+func (m LedgerModel) forget(receipt *Receipt) {
+	if receipt.AccountID == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, exists := m.accounts[ledgerKey(receipt.Tenant, receipt.AccountID)]; exists {
+		delete(l.earned, receipt.ID)
+		m.retier(l, receipt.Tenant, receipt.AccountID, receipt.ID, time.Now())
+	}
+}
+
+// tier() returns the tier of the points the account earned over the 12 months before
+// now. The caller must hold the lock.
+func (m LedgerModel) tier(l *accountLedger, tenant string, now time.Time) Tier {
+	return tierFor(m.tiers.For(tenant), l.earnedSince(now.AddDate(0, -tierWindowMonths, 0)))
+}
+
+// retier() moves the account to the tier its points earn it, publishing a TierChanged
+// event when that is a different tier. The caller must hold the lock.
+func (m LedgerModel) retier(l *accountLedger, tenant, account string, receiptID uuid.UUID, now time.Time) {
+	tier := m.tier(l, tenant, now)
+	if tier.Name == l.tier {
+		return
+	}
+
+	m.events.Publish(TierChanged{Tenant: tenant, AccountID: account, Before: l.tier, After: tier.Name, ReceiptID: receiptID, At: now})
+	l.tier = tier.Name
+}
+
+// Tier returns the tier the account's receipts are currently scored in.
+func (m LedgerModel) Tier(tenant, account string, now time.Time) Tier {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l, exists := m.accounts[ledgerKey(tenant, account)]
+	if !exists {
+		return m.tiers.For(tenant)[0]
+	}
+
+	return m.tier(l, tenant, now)
+}
+
+// Expire writes an expiry entry for every expiration due by now that hasn't been written
+// yet, and returns the number of entries and points written. Expirations are worked out
+// from the earn entries, so after a restart the same entries are written again with the
+// same times. Accounts whose points dropped out of the tier window move down a tier.
+func (m LedgerModel) Expire(now time.Time) (int, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries int
+	var points int64
+	for key, l := range m.accounts {
+		tenant, account, _ := strings.Cut(key, "/")
+		m.retier(l, tenant, account, uuid.Nil, now)
+		for _, expiration := range l.expirations(m.policies.For(tenant)) {
+			if expiration.ExpiresAt.After(now) || l.written(expiration) {
+				continue
+			}
+			l.expired = append(l.expired, LedgerEntry{Type: LedgerExpire, Points: -expiration.Points, At: expiration.ExpiresAt})
+			entries++
+			points += expiration.Points
+		}
+	}
+
+	return entries, points
+}
+
+// Expirations returns the account's balance and the expirations that haven't been
+// written to its ledger yet. Expirations already due are included until Expire writes
+// them.
+func (m LedgerModel) Expirations(tenant, account string) AccountExpirations {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	policy := m.policies.For(tenant)
+	report := AccountExpirations{AccountID: account, Policy: policy, Upcoming: []*Expiration{}}
+
+	l, exists := m.accounts[ledgerKey(tenant, account)]
+	if !exists {
+		return report
+	}
+
+	for _, e := range l.earned {
+		report.Balance += e.Points
+	}
+	for _, e := range l.expired {
+		report.Balance += e.Points
+	}
+	report.Balance = max(report.Balance, 0)
+
+	for _, expiration := range l.expirations(policy) {
+		if !l.written(expiration) {
+			report.Upcoming = append(report.Upcoming, expiration)
+		}
+	}
+
+	return report
+}
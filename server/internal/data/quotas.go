@@ -0,0 +1,205 @@
+package data
+
+import (
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	QuotaReceipts         = "receiptsPerDay"
+	QuotaRetailerReceipts = "retailerReceiptsPerDay"
+	QuotaPoints           = "pointsPerDay"
+
+	// What happens to a receipt that would take its account over a quota: it is either
+	// rejected with a QuotaExceededError, or stored with the quotas it exceeded in its
+	// Flags.
+	QuotaModeReject = "reject"
+	QuotaModeFlag   = "flag"
+)
+
+// QuotaLimits are the daily submission limits of a single account. Days are UTC
+// calendar days, and a zero limit means no limit.
+type QuotaLimits struct {
+	ReceiptsPerDay         int64 `json:"receiptsPerDay,omitempty"`
+	RetailerReceiptsPerDay int64 `json:"retailerReceiptsPerDay,omitempty"`
+	PointsPerDay           int64 `json:"pointsPerDay,omitempty"`
+}
+
+func ValidateQuotaLimits(v *validator.Validator, l QuotaLimits) {
+	v.Check(l.ReceiptsPerDay >= 0, QuotaReceipts, "must not be negative")
+	v.Check(l.RetailerReceiptsPerDay >= 0, QuotaRetailerReceipts, "must not be negative")
+	v.Check(l.PointsPerDay >= 0, QuotaPoints, "must not be negative")
+}
+
+// Quotas holds the limits of the tenants that have their own quotas, and the default
+// limits used by every other tenant.
+type Quotas struct {
+	Mode    string
+	Default QuotaLimits
+	Tenants map[string]QuotaLimits
+}
+
+// For returns the quota limits of the tenant's accounts.
+func (q Quotas) For(tenant string) QuotaLimits {
+	if limits, exists := q.Tenants[tenant]; exists {
+		return limits
+	}
+
+	return q.Default
+}
+
+// QuotaStatus is the state of one quota of an account for the current day.
+type QuotaStatus struct {
+	Quota     string `json:"quota"`
+	Retailer  string `json:"retailer,omitempty"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+}
+
+// QuotaUsage reports an account's limited quotas for the current day.
+type QuotaUsage struct {
+	AccountID string         `json:"accountId"`
+	ResetsAt  time.Time      `json:"resetsAt"`
+	Quotas    []*QuotaStatus `json:"quotas"`
+}
+
+// QuotaExceededError is returned by Insert when a receipt would take its account over
+// one or more quotas and the quota mode is QuotaModeReject.
+type QuotaExceededError struct {
+	Exceeded []string
+	Usage    QuotaUsage
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s", strings.Join(e.Exceeded, ", "))
+}
+
+// accountUsage counts what one account submitted on a single day.
+type accountUsage struct {
+	day       time.Time
+	receipts  int64
+	points    int64
+	retailers map[string]int64
+}
+
+// QuotaModel tracks the daily usage of every account. Receipts without an account are
+// not subject to quotas.
+type QuotaModel struct {
+	quotas Quotas
+	usage  map[string]*accountUsage
+	mu     *sync.Mutex
+}
+
+func quotaKey(tenant, account string) string {
+	return tenant + "/" + account
+}
+
+func quotaRetailer(receipt *Receipt) string {
+	return strings.ToLower(receipt.CanonicalRetailer())
+}
+
+// today() returns the account's usage for the day starting at day, starting it over
+// when the usage recorded so far is from an earlier day. The caller must hold the lock.
+func (m QuotaModel) today(tenant, account string, day time.Time) *accountUsage {
+	usage, exists := m.usage[quotaKey(tenant, account)]
+	if !exists || usage.day.Before(day) {
+		usage = &accountUsage{day: day, retailers: make(map[string]int64)}
+		m.usage[quotaKey(tenant, account)] = usage
+	}
+
+	return usage
+}
+
+// status() returns the state of the account's limited quotas, including the
+// per-retailer quota of retailer when it is not empty. The caller must hold the lock.
+func (m QuotaModel) status(tenant, account, retailer string, usage *accountUsage) QuotaUsage {
+	limits := m.quotas.For(tenant)
+	status := QuotaUsage{
+		AccountID: account,
+		ResetsAt:  usage.day.Add(day),
+		Quotas:    []*QuotaStatus{},
+	}
+
+	add := func(quota, retailer string, limit, used int64) {
+		if limit > 0 {
+			status.Quotas = append(status.Quotas, &QuotaStatus{Quota: quota, Retailer: retailer, Limit: limit, Used: used, Remaining: max(limit-used, 0)})
+		}
+	}
+	add(QuotaReceipts, "", limits.ReceiptsPerDay, usage.receipts)
+	if retailer != "" {
+		add(QuotaRetailerReceipts, retailer, limits.RetailerReceiptsPerDay, usage.retailers[strings.ToLower(retailer)])
+	}
+	add(QuotaPoints, "", limits.PointsPerDay, usage.points)
+
+	return status
+}
+
+// check returns the quotas a new, already scored receipt would take its account over.
+// In QuotaModeReject it returns a QuotaExceededError instead.
+func (m QuotaModel) check(receipt *Receipt) ([]string, error) {
+	if receipt.AccountID == "" {
+		return nil, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limits := m.quotas.For(receipt.Tenant)
+	usage := m.today(receipt.Tenant, receipt.AccountID, receipt.CreatedAt.UTC().Truncate(day))
+
+	var exceeded []string
+	if limits.ReceiptsPerDay > 0 && usage.receipts+1 > limits.ReceiptsPerDay {
+		exceeded = append(exceeded, QuotaReceipts)
+	}
+	if limits.RetailerReceiptsPerDay > 0 && usage.retailers[quotaRetailer(receipt)]+1 > limits.RetailerReceiptsPerDay {
+		exceeded = append(exceeded, QuotaRetailerReceipts)
+	}
+	if limits.PointsPerDay > 0 && usage.points+int64(receipt.Points+receipt.PendingPoints) > limits.PointsPerDay {
+		exceeded = append(exceeded, QuotaPoints)
+	}
+
+	if len(exceeded) > 0 && m.quotas.Mode != QuotaModeFlag {
+		return nil, &QuotaExceededError{
+			Exceeded: exceeded,
+			Usage:    m.status(receipt.Tenant, receipt.AccountID, receipt.CanonicalRetailer(), usage),
+		}
+	}
+	return exceeded, nil
+}
+
+// record counts a stored receipt against its account's quotas for the day it was
+// submitted on. Usage from earlier days is dropped as soon as the account submits again.
+func (m QuotaModel) record(receipt *Receipt) {
+	if receipt.AccountID == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	date := receipt.CreatedAt.UTC().Truncate(day)
+	usage := m.today(receipt.Tenant, receipt.AccountID, date)
+	if !usage.day.Equal(date) {
+		return
+	}
+
+	usage.receipts++
+	usage.retailers[quotaRetailer(receipt)]++
+	usage.points += int64(receipt.Points + receipt.PendingPoints)
+}
+
+// Usage returns the account's quotas for the current day. When retailer is not empty
+// the per-retailer quota for that retailer is included.
+func (m QuotaModel) Usage(tenant, account, retailer string) QuotaUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := &accountUsage{day: time.Now().UTC().Truncate(day), retailers: map[string]int64{}}
+	if account != "" {
+		usage = m.today(tenant, account, usage.day)
+	}
+
+	return m.status(tenant, account, retailer, usage)
+}
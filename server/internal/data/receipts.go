@@ -5,6 +5,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"html"
+	"slices"
 	"sync"
 	"time"
 )
@@ -12,18 +13,40 @@ import (
 type Item struct {
 	ShortDescription string `json:"shortDescription"`
 	Price            Price  `json:"price"`
+	Category         string `json:"category,omitempty"`
+	CategoryOverride bool   `json:"categoryOverride,omitempty"`
 }
 
 type Receipt struct {
-	ID           uuid.UUID `json:"id,string"`
-	CreatedAt    time.Time `json:"-"`
-	Retailer     string    `json:"retailer"`
-	PurchaseDate string    `json:"purchaseDate"`
-	PurchaseTime string    `json:"purchaseTime"`
-	Items        []Item    `json:"items"`
-	Total        Price     `json:"total"`
-	Points       int32     `json:"points"`
-	Version      int32     `json:"version"`
+	ID            uuid.UUID    `json:"id,string"`
+	CreatedAt     time.Time    `json:"-"`
+	Tenant        string       `json:"tenant"`
+	AccountID     string       `json:"accountId,omitempty"`
+	Retailer      string       `json:"retailer"`
+	RetailerID    *uuid.UUID   `json:"retailerId,omitempty"`
+	RetailerName  string       `json:"retailerName,omitempty"`
+	PurchaseDate  string       `json:"purchaseDate"`
+	PurchaseTime  string       `json:"purchaseTime"`
+	Items         []Item       `json:"items"`
+	Total         Price        `json:"total"`
+	Points        int32        `json:"points"`
+	Breakdown     []PointsLine `json:"breakdown,omitempty"`
+	Flags         []string     `json:"flags,omitempty"`
+	Risk          *Risk        `json:"risk,omitempty"`
+	Status        string       `json:"status"`
+	PendingPoints int32        `json:"pendingPoints,omitempty"`
+	Review        *Review      `json:"review,omitempty"`
+	Version       int32        `json:"version"`
+}
+
+// CanonicalRetailer returns the catalog name the receipt's retailer was normalized to,
+// falling back to the raw retailer string when it didn't match the catalog.
+func (r *Receipt) CanonicalRetailer() string {
+	if r.RetailerName != "" {
+		return r.RetailerName
+	}
+
+	return r.Retailer
 }
 
 func ValidateReceipt(v *validator.Validator, receipt *Receipt) {
@@ -41,52 +64,154 @@ func ValidateReceipt(v *validator.Validator, receipt *Receipt) {
 	v.Check(receipt.Total.GreaterThan(decimal.Zero) && receipt.Total.IsPositive(), "total", "must be positive")
 }
 
-func CalculatePoints(c *Calculator, receipt *Receipt) int32 {
-	c.AddPoints(RetailerNamePoints(receipt.Retailer))
-	c.AddPoints(RoundDollarPoints(receipt.Total))
-	c.AddPoints(QuarterMultiplePoints(receipt.Total))
-	c.AddPoints(ItemPairPoints(receipt.Items))
-	c.AddPoints(ItemDescriptionPoints(receipt.Items))
-	c.AddPoints(OddDayPoints(receipt.PurchaseDate, "2006-01-02"))
-	c.AddPoints(PurchaseTimeRangePoints(receipt.PurchaseTime, "15:04"))
+func CalculatePoints(c *Calculator, receipt *Receipt, campaigns []*Campaign) int32 {
+	c.AddRule(RuleRetailerName, RetailerNamePoints(receipt.CanonicalRetailer()))
+	c.AddRule(RuleRoundDollar, RoundDollarPoints(receipt.Total))
+	c.AddRule(RuleQuarterMultiple, QuarterMultiplePoints(receipt.Total))
+	c.AddRule(RuleItemPairs, ItemPairPoints(receipt.Items))
+	c.AddRule(RuleItemDescriptions, ItemDescriptionPoints(receipt.Items))
+	c.AddRule(RuleOddDay, OddDayPoints(receipt.PurchaseDate, "2006-01-02"))
+	c.AddRule(RulePurchaseTime, PurchaseTimeRangePoints(receipt.PurchaseTime, "15:04"))
+	c.AddRule(RuleCampaigns, CampaignPoints(campaigns, receipt, c.TotalPoints()))
 
 	return c.TotalPoints()
 }
 
+// ReceiptModel stores the receipts of every tenant. Every read and write is scoped to a
+// single tenant, and a receipt of another tenant behaves exactly like a missing one.
 type ReceiptModel struct {
-	Store map[string]Receipt
-	mu    *sync.RWMutex
+	Store        map[string]Receipt
+	mu           *sync.RWMutex
+	campaigns    CampaignModel
+	retailers    RetailerModel
+	categorizers Categorizers
+	quotas       QuotaModel
+	risk         RiskModel
+	ledger       LedgerModel
+	events       *EventBus
 }
 
 func (m ReceiptModel) Insert(receipt *Receipt) error {
+	return m.insert(receipt, nil)
+}
+
+// insert scores and stores a new receipt for the receipt's tenant, using that tenant's
+// category rules and campaigns and its account's loyalty tier, counts it against its account's quotas, scores its
+// fraud risk and credits its points to its account's ledger. When record is set it is called with the
+// resulting event before the receipt is stored, and an error from it aborts the insert.
+func (m ReceiptModel) insert(receipt *Receipt, record func(LoggedEvent) error) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	receipt.Tenant = TenantOrDefault(receipt.Tenant)
+	campaigns, err := m.campaigns.GetAll(receipt.Tenant)
+	if err != nil {
+		return err
+	}
+	categorizer := m.categorizers.For(receipt.Tenant)
+	for i := range receipt.Items {
+		if !receipt.Items[i].CategoryOverride {
+			receipt.Items[i].Category = categorizer.Categorize(receipt.Items[i].ShortDescription)
+		}
+	}
 	c := New()
 
 	receipt.ID = uuid.New()
 	receipt.Retailer = html.UnescapeString(receipt.Retailer)
+	if retailer, ok := m.retailers.Match(receipt.Retailer); ok {
+		receipt.RetailerID = &retailer.ID
+		receipt.RetailerName = retailer.Name
+	}
 	receipt.CreatedAt = time.Now()
-	receipt.Points = CalculatePoints(c, receipt)
+	receipt.Points = CalculatePoints(c, receipt, campaigns)
+	if receipt.AccountID != "" {
+		ApplyTier(c, m.ledger.Tier(receipt.Tenant, receipt.AccountID, receipt.CreatedAt))
+		receipt.Points = c.TotalPoints()
+	}
+	receipt.Breakdown = c.Lines
+
+	exceeded, err := m.quotas.check(receipt)
+	if err != nil {
+		return err
+	}
+	for _, quota := range exceeded {
+		receipt.Flags = append(receipt.Flags, "quota:"+quota)
+	}
+
+	// Receipts that look fraudulent are held for review, and their points stay
+	// pending until a reviewer approves them.
+	receipt.Risk = m.risk.assess(receipt, receipt.CreatedAt)
+	receipt.Status = StatusApproved
+	if receipt.Risk.Score >= m.risk.threshold {
+		receipt.Status = StatusPending
+		receipt.PendingPoints = receipt.Points
+		receipt.Points = 0
+	}
 	receipt.Version += 1
 
+	if record != nil {
+		err = record(LoggedEvent{Type: ReceiptCreated{}.Name(), At: receipt.CreatedAt, Receipt: *receipt})
+		if err != nil {
+			return err
+		}
+	}
+
 	m.Store[receipt.ID.String()] = *receipt
+	m.quotas.record(receipt)
+	m.risk.record(receipt)
+	m.ledger.record(receipt)
+	m.events.Publish(ReceiptCreated{Receipt: *receipt, At: receipt.CreatedAt})
 	return nil
 }
 
-func (m ReceiptModel) GetAll() ([]*Receipt, error) {
+func (m ReceiptModel) GetAll(tenant string, filters ReceiptFilters) ([]*Receipt, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	receipts := make([]*Receipt, 0, len(m.Store))
 	for _, receipt := range m.Store {
-		receipts = append(receipts, &receipt)
+		if receipt.Tenant == tenant && filters.Match(&receipt) {
+			receipts = append(receipts, &receipt)
+		}
 	}
+	slices.SortFunc(receipts, func(a, b *Receipt) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
 
 	return receipts, nil
 }
 
-func (m ReceiptModel) Get(id uuid.UUID) (*Receipt, error) {
+// IDs returns the ids of the receipts matching the filters in the same order as
+// GetAll, without copying the receipts themselves. Callers that stream large result
+// sets fetch each receipt with Get as they go.
+func (m ReceiptModel) IDs(tenant string, filters ReceiptFilters) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type entry struct {
+		id        uuid.UUID
+		createdAt time.Time
+	}
+
+	entries := make([]entry, 0, len(m.Store))
+	for _, receipt := range m.Store {
+		if receipt.Tenant == tenant && filters.Match(&receipt) {
+			entries = append(entries, entry{receipt.ID, receipt.CreatedAt})
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return a.createdAt.Compare(b.createdAt)
+	})
+
+	ids := make([]uuid.UUID, len(entries))
+	for i, e := range entries {
+		ids[i] = e.id
+	}
+
+	return ids, nil
+}
+
+func (m ReceiptModel) Get(tenant string, id uuid.UUID) (*Receipt, error) {
 	if id == uuid.Nil {
 		return nil, ErrRecordNotFound
 	}
@@ -94,9 +219,92 @@ func (m ReceiptModel) Get(id uuid.UUID) (*Receipt, error) {
 	defer m.mu.RUnlock()
 
 	receipt, exists := m.Store[id.String()]
-	if !exists {
+	if !exists || receipt.Tenant != tenant {
 		return nil, ErrRecordNotFound
 	}
 
 	return &receipt, nil
 }
+
+func (m ReceiptModel) Update(receipt *Receipt) error {
+	return m.update(receipt, nil)
+}
+
+// update is Update with the same record hook as insert. The receipt keeps the tenant it
+// was read with, so it can only replace a receipt of that tenant.
+func (m ReceiptModel) update(receipt *Receipt, record func(LoggedEvent) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, exists := m.Store[receipt.ID.String()]
+	if !exists || stored.Tenant != receipt.Tenant {
+		return ErrRecordNotFound
+	}
+	if stored.Version != receipt.Version {
+		return ErrEditConflict
+	}
+
+	receipt.Version += 1
+	now := time.Now()
+	if record != nil {
+		err := record(LoggedEvent{Type: ReceiptUpdated{}.Name(), At: now, Receipt: *receipt})
+		if err != nil {
+			receipt.Version -= 1
+			return err
+		}
+	}
+
+	m.Store[receipt.ID.String()] = *receipt
+	m.ledger.record(receipt)
+	m.events.Publish(ReceiptUpdated{Before: stored, After: *receipt, At: now})
+	if stored.Points != receipt.Points {
+		m.events.Publish(PointsAdjusted{ReceiptID: receipt.ID, Before: stored.Points, After: receipt.Points, At: now})
+	}
+	return nil
+}
+
+// Delete removes a receipt and returns it as it was stored.
+func (m ReceiptModel) Delete(tenant string, id uuid.UUID) (*Receipt, error) {
+	return m.delete(tenant, id, nil)
+}
+
+// delete is Delete with the same record hook as insert.
+func (m ReceiptModel) delete(tenant string, id uuid.UUID, record func(LoggedEvent) error) (*Receipt, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	receipt, exists := m.Store[id.String()]
+	if !exists || receipt.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	now := time.Now()
+	if record != nil {
+		err := record(LoggedEvent{Type: ReceiptDeleted{}.Name(), At: now, Receipt: receipt})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	delete(m.Store, id.String())
+	m.risk.forget(&receipt)
+	m.ledger.forget(&receipt)
+	m.events.Publish(ReceiptDeleted{Receipt: receipt, At: now})
+	return &receipt, nil
+}
+
+// Len returns the number of receipts stored across all tenants.
+func (m ReceiptModel) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.Store)
+}
+
+// Categories returns the item categories known to the tenant's categorizer.
+func (m ReceiptModel) Categories(tenant string) []string {
+	return m.categorizers.For(tenant).Categories()
+}
@@ -0,0 +1,240 @@
+package data
+
+import (
+	"errors"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicateRetailer = errors.New("duplicate retailer")
+
+	storeNumberRX = regexp.MustCompile(`(?i)(#|\bno\.?)\s*\d+`)
+	nonAlphaNumRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type Retailer struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases,omitempty"`
+	Patterns  []string  `json:"patterns,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	Version   int32     `json:"version"`
+	compiled  []*regexp.Regexp
+}
+
+// NormalizeRetailerName lowercases a retailer name, drops store numbers such as "#123"
+// and collapses everything that isn't a letter or digit, so "Target Store #123" and
+// "TARGET  store" both normalize to "target store".
+func NormalizeRetailerName(name string) string {
+	name = storeNumberRX.ReplaceAllString(name, " ")
+	name = nonAlphaNumRX.ReplaceAllString(strings.ToLower(name), " ")
+
+	return strings.TrimSpace(name)
+}
+
+func (r *Retailer) compile() error {
+	r.compiled = make([]*regexp.Regexp, 0, len(r.Patterns))
+	for _, pattern := range r.Patterns {
+		rx, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		r.compiled = append(r.compiled, rx)
+	}
+
+	return nil
+}
+
+// names returns the normalized canonical name and aliases of the retailer.
+func (r *Retailer) names() []string {
+	names := []string{NormalizeRetailerName(r.Name)}
+	for _, alias := range r.Aliases {
+		names = append(names, NormalizeRetailerName(alias))
+	}
+
+	return names
+}
+
+func ValidateRetailer(v *validator.Validator, retailer *Retailer) {
+	v.Check(retailer.Name != "", "name", "must be provided")
+	v.Check(len(retailer.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(NormalizeRetailerName(retailer.Name) != "", "name", "must contain at least one letter or digit")
+	for _, alias := range retailer.Aliases {
+		v.Check(NormalizeRetailerName(alias) != "", "aliases", "must contain at least one letter or digit")
+	}
+	v.Check(validator.Unique(retailer.names()), "aliases", "must not contain duplicate values")
+	v.Check(retailer.compile() == nil, "patterns", "must only contain valid regular expressions")
+	v.Check(len(retailer.Category) <= 100, "category", "must not be more than 100 bytes long")
+}
+
+// retailerIndex is the catalog prepared for matching receipts: the retailers by
+// normalized name and alias, and in name order for trying their patterns.
+type retailerIndex struct {
+	names  map[string]*Retailer
+	sorted []*Retailer
+}
+
+type RetailerModel struct {
+	Store map[string]Retailer
+	index *retailerIndex
+	mu    *sync.RWMutex
+}
+
+// reindex() rebuilds the match index after the catalog changed. The caller must hold
+// the lock.
+func (m RetailerModel) reindex() {
+	index := retailerIndex{names: make(map[string]*Retailer), sorted: m.sorted()}
+	for _, retailer := range index.sorted {
+		for _, name := range retailer.names() {
+			index.names[name] = retailer
+		}
+	}
+
+	*m.index = index
+}
+
+// conflicts reports whether any name or alias of the retailer is already claimed by
+// another retailer in the catalog. The caller must hold the lock.
+func (m RetailerModel) conflicts(retailer *Retailer) bool {
+	names := retailer.names()
+	for _, stored := range m.Store {
+		if stored.ID == retailer.ID {
+			continue
+		}
+		for _, name := range stored.names() {
+			if slices.Contains(names, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m RetailerModel) Insert(retailer *Retailer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conflicts(retailer) {
+		return ErrDuplicateRetailer
+	}
+	if err := retailer.compile(); err != nil {
+		return err
+	}
+
+	retailer.ID = uuid.New()
+	retailer.CreatedAt = time.Now()
+	retailer.Version = 1
+
+	m.Store[retailer.ID.String()] = *retailer
+	m.reindex()
+	return nil
+}
+
+// sorted returns the catalog ordered by canonical name. The caller must hold the lock.
+func (m RetailerModel) sorted() []*Retailer {
+	retailers := make([]*Retailer, 0, len(m.Store))
+	for _, retailer := range m.Store {
+		retailers = append(retailers, &retailer)
+	}
+	slices.SortFunc(retailers, func(a, b *Retailer) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return retailers
+}
+
+func (m RetailerModel) GetAll() ([]*Retailer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sorted(), nil
+}
+
+func (m RetailerModel) Get(id uuid.UUID) (*Retailer, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	retailer, exists := m.Store[id.String()]
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+
+	return &retailer, nil
+}
+
+func (m RetailerModel) Update(retailer *Retailer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, exists := m.Store[retailer.ID.String()]
+	if !exists {
+		return ErrRecordNotFound
+	}
+	if stored.Version != retailer.Version {
+		return ErrEditConflict
+	}
+	if m.conflicts(retailer) {
+		return ErrDuplicateRetailer
+	}
+	if err := retailer.compile(); err != nil {
+		return err
+	}
+
+	retailer.Version += 1
+	m.Store[retailer.ID.String()] = *retailer
+	m.reindex()
+	return nil
+}
+
+// Delete removes a retailer and returns it as it was stored.
+func (m RetailerModel) Delete(id uuid.UUID) (*Retailer, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	retailer, exists := m.Store[id.String()]
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+
+	delete(m.Store, id.String())
+	m.reindex()
+	return &retailer, nil
+}
+
+// Match resolves a raw retailer string from a receipt to a catalog entry, first by
+// normalized name or alias and then by the retailers' regex patterns, tried in name
+// order.
+func (m RetailerModel) Match(raw string) (*Retailer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if retailer, exists := m.index.names[NormalizeRetailerName(raw)]; exists {
+		match := *retailer
+		return &match, true
+	}
+
+	for _, retailer := range m.index.sorted {
+		for _, rx := range retailer.compiled {
+			if rx.MatchString(raw) {
+				match := *retailer
+				return &match, true
+			}
+		}
+	}
+
+	return nil, false
+}
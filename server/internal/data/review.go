@@ -0,0 +1,67 @@
+package data
+
+import (
+	"errors"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"time"
+)
+
+const (
+	// A receipt is pending while it is held for review, and approved or rejected once a
+	// reviewer has decided. Receipts that were never held are approved when stored.
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+var ErrNotPendingReview = errors.New("receipt is not pending review")
+
+// Review is a reviewer's decision on a receipt that was held for review.
+type Review struct {
+	Decision string    `json:"decision"`
+	Reason   string    `json:"reason,omitempty"`
+	Reviewer string    `json:"reviewer"`
+	At       time.Time `json:"at"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(validator.PermittedValue(review.Decision, DecisionApprove, DecisionReject), "decision", "must be approve or reject")
+	if review.Decision == DecisionReject {
+		v.Check(review.Reason != "", "reason", "must be provided when rejecting")
+	}
+	v.Check(len(review.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+// ApplyReview records a decision on a receipt pending review. Approving the receipt
+// awards its pending points, rejecting it leaves them pending for good. The receipt
+// still has to be saved with Update.
+func (r *Receipt) ApplyReview(review Review) error {
+	if r.Status != StatusPending {
+		return ErrNotPendingReview
+	}
+
+	switch review.Decision {
+	case DecisionApprove:
+		r.Status = StatusApproved
+		r.Points = r.PendingPoints
+		r.PendingPoints = 0
+	case DecisionReject:
+		r.Status = StatusRejected
+	}
+	r.Review = &review
+
+	return nil
+}
+
+// receiptStatus returns the status of a receipt. Receipts in event logs written before
+// receipts were scored for risk have none, and they were never held for review.
+func receiptStatus(receipt *Receipt) string {
+	if receipt.Status != "" {
+		return receipt.Status
+	}
+
+	return StatusApproved
+}
@@ -0,0 +1,194 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RiskFuturePurchaseDate = "futurePurchaseDate"
+	RiskImplausibleTime    = "implausiblePurchaseTime"
+	RiskTotalMismatch      = "itemsTotalMismatch"
+	RiskDescriptionGaming  = "descriptionGaming"
+	RiskDuplicate          = "duplicateFingerprint"
+	RiskVelocity           = "submissionVelocity"
+
+	// Receipts scoring at least this much are held for review by default.
+	DefaultRiskThreshold = 50
+
+	// An account submitting riskVelocityLimit receipts within riskVelocityWindow is
+	// submitting faster than a person collecting receipts plausibly would.
+	riskVelocityWindow = 10 * time.Minute
+	riskVelocityLimit  = 10
+
+	// A round-dollar total with at least riskGamingItems items with a 3-character
+	// description costing at most riskGamingItemPrice each looks built to collect
+	// ItemDescriptionPoints and RoundDollarPoints.
+	riskGamingItems     = 5
+	riskGamingItemPrice = "2.00"
+
+	// How far the total may exceed the sum of the item prices, to allow for tax.
+	riskTotalSurplus = "0.25"
+)
+
+// RiskSignal is one reason a receipt looks fraudulent, with the score it contributes.
+type RiskSignal struct {
+	Signal string `json:"signal"`
+	Score  int    `json:"score"`
+	Detail string `json:"detail"`
+}
+
+// Risk is a receipt's fraud risk score, from 0 to 100, and the signals behind it.
+type Risk struct {
+	Score   int           `json:"score"`
+	Signals []*RiskSignal `json:"signals,omitempty"`
+}
+
+func (r *Risk) add(signal string, score int, detail string) {
+	r.Score = min(r.Score+score, 100)
+	r.Signals = append(r.Signals, &RiskSignal{Signal: signal, Score: score, Detail: detail})
+}
+
+// Fingerprint identifies a purchase independently of who submitted it and when: two
+// receipts with the same fingerprint describe the same retailer, date, time, items
+// and total.
+func Fingerprint(receipt *Receipt) string {
+	items := make([]string, len(receipt.Items))
+	for i, item := range receipt.Items {
+		items[i] = strings.ToLower(strings.TrimSpace(item.ShortDescription)) + "=" + item.Price.String()
+	}
+	slices.Sort(items)
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(receipt.CanonicalRetailer()),
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		receipt.Total.String(),
+		strings.Join(items, "\n"),
+	}, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// RiskModel scores new receipts. It remembers the fingerprints of the stored receipts
+// and the recent submissions of every account for the signals that depend on more than
+// the receipt itself.
+type RiskModel struct {
+	threshold    int
+	fingerprints map[string]int
+	submissions  map[string][]time.Time
+	mu           *sync.Mutex
+}
+
+// assess() scores a new receipt submitted at now.
+func (m RiskModel) assess(receipt *Receipt, now time.Time) *Risk {
+	risk := &Risk{}
+	assessPurchase(risk, receipt, now)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := m.fingerprints[receipt.Tenant+"/"+Fingerprint(receipt)]; n > 0 {
+		risk.add(RiskDuplicate, 50, fmt.Sprintf("%d earlier receipt(s) have the same retailer, date, time, items and total", n))
+	}
+
+	if receipt.AccountID != "" {
+		recent := m.recent(receipt.Tenant+"/"+receipt.AccountID, now)
+		if len(recent)+1 >= riskVelocityLimit {
+			risk.add(RiskVelocity, 25, fmt.Sprintf("%d receipts submitted by the account in the last %s", len(recent)+1, riskVelocityWindow))
+		}
+	}
+
+	return risk
+}
+
+// assessPurchase() adds the signals that only depend on the receipt itself.
+func assessPurchase(risk *Risk, receipt *Receipt, now time.Time) {
+	// Allow a day for purchases made in time zones ahead of UTC.
+	purchased, err := time.Parse("2006-01-02 15:04", receipt.PurchaseDate+" "+receipt.PurchaseTime)
+	if err == nil && purchased.After(now.UTC().Add(day)) {
+		risk.add(RiskFuturePurchaseDate, 40, "purchase date is in the future")
+	}
+	if err == nil && purchased.Hour() >= 1 && purchased.Hour() < 5 {
+		risk.add(RiskImplausibleTime, 10, "purchase time is between 01:00 and 05:00")
+	}
+
+	sum := decimal.Zero
+	for _, item := range receipt.Items {
+		sum = sum.Add(item.Price.Decimal)
+	}
+	surplus := sum.Mul(decimal.RequireFromString(riskTotalSurplus).Add(decimal.NewFromInt(1)))
+	switch {
+	case receipt.Total.LessThan(sum):
+		risk.add(RiskTotalMismatch, 30, fmt.Sprintf("total %s is less than the item prices' sum of %s", receipt.Total, sum.StringFixed(2)))
+	case receipt.Total.GreaterThan(surplus):
+		risk.add(RiskTotalMismatch, 20, fmt.Sprintf("total %s exceeds the item prices' sum of %s by more than tax would", receipt.Total, sum.StringFixed(2)))
+	}
+
+	if RoundDollarPoints(receipt.Total) > 0 {
+		cheap := 0
+		for _, item := range receipt.Items {
+			if len(strings.TrimSpace(item.ShortDescription)) == 3 && item.Price.LessThanOrEqual(decimal.RequireFromString(riskGamingItemPrice)) {
+				cheap++
+			}
+		}
+		if cheap >= riskGamingItems {
+			risk.add(RiskDescriptionGaming, 35, fmt.Sprintf("round-dollar total with %d cheap items with 3-character descriptions", cheap))
+		}
+	}
+}
+
+// recent() returns the account's submissions within riskVelocityWindow of now,
+// forgetting older ones. The caller must hold the lock.
+func (m RiskModel) recent(key string, now time.Time) []time.Time {
+	times := m.submissions[key]
+	cutoff := now.Add(-riskVelocityWindow)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+
+	if len(times) == 0 {
+		delete(m.submissions, key)
+	} else {
+		m.submissions[key] = times
+	}
+	return times
+}
+
+// record remembers a stored receipt's fingerprint and counts its submission towards
+// its account's velocity.
+func (m RiskModel) record(receipt *Receipt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fingerprints[receipt.Tenant+"/"+Fingerprint(receipt)]++
+
+	if receipt.AccountID != "" {
+		key := receipt.Tenant + "/" + receipt.AccountID
+		recent := m.recent(key, time.Now())
+		if receipt.CreatedAt.After(time.Now().Add(-riskVelocityWindow)) {
+			recent = append(recent, receipt.CreatedAt)
+			slices.SortFunc(recent, time.Time.Compare)
+			m.submissions[key] = recent
+		}
+	}
+}
+
+// forget drops a deleted receipt's fingerprint.
+func (m RiskModel) forget(receipt *Receipt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := receipt.Tenant + "/" + Fingerprint(receipt)
+	m.fingerprints[key]--
+	if m.fingerprints[key] <= 0 {
+		delete(m.fingerprints, key)
+	}
+}
@@ -0,0 +1,278 @@
+package data
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/shopspring/decimal"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TopRetailersLimit = 10
+
+// aggregate holds the running totals for the receipts of one retailer on one purchase
+// date. PointCounts counts receipts by points awarded, which is enough to answer
+// median and percentile queries without keeping every receipt.
+type aggregate struct {
+	receipts    int64
+	points      int64
+	spend       decimal.Decimal
+	pointCounts map[int32]int64
+}
+
+func (a *aggregate) merge(other *aggregate) {
+	a.receipts += other.receipts
+	a.points += other.points
+	a.spend = a.spend.Add(other.spend)
+	for points, count := range other.pointCounts {
+		a.pointCounts[points] += count
+	}
+}
+
+func newAggregate() *aggregate {
+	return &aggregate{pointCounts: make(map[int32]int64)}
+}
+
+type StatsFilters struct {
+	From    string
+	To      string
+	GroupBy string
+}
+
+func ValidateStatsFilters(v *validator.Validator, f StatsFilters) {
+	if f.From != "" {
+		v.Check(validator.TimeFormat(f.From, "2006-01-02"), "from", "must be in the format YYYY-MM-DD")
+	}
+	if f.To != "" {
+		v.Check(validator.TimeFormat(f.To, "2006-01-02"), "to", "must be in the format YYYY-MM-DD")
+	}
+	if f.From != "" && f.To != "" {
+		v.Check(f.From <= f.To, "to", "must not be before from")
+	}
+	if f.GroupBy != "" {
+		v.Check(validator.PermittedValue(f.GroupBy, "day", "week", "month", "retailer"), "group_by", "must be day, week, month or retailer")
+	}
+}
+
+type RetailerStats struct {
+	Retailer string `json:"retailer"`
+	Receipts int64  `json:"receipts"`
+	Points   int64  `json:"points"`
+	Spend    Price  `json:"spend"`
+}
+
+type Stats struct {
+	Receipts      int64            `json:"receipts"`
+	TotalPoints   int64            `json:"totalPoints"`
+	AveragePoints float64          `json:"averagePoints"`
+	MedianPoints  int32            `json:"medianPoints"`
+	P95Points     int32            `json:"p95Points"`
+	TotalSpend    Price            `json:"totalSpend"`
+	TopRetailers  []*RetailerStats `json:"topRetailers,omitempty"`
+}
+
+type StatsGroup struct {
+	Key   string `json:"key"`
+	Stats *Stats `json:"stats"`
+}
+
+// StatsModel maintains receipt aggregates incrementally, bucketed by tenant, purchase
+// date and canonical retailer, so queries only ever walk the buckets of one tenant and
+// never the receipts. The aggregates are updated from receipt events on the EventBus,
+// after the change is stored, so reads may briefly lag behind the receipts.
+type StatsModel struct {
+	tenants map[string]map[string]map[string]*aggregate
+	mu      *sync.RWMutex
+}
+
+func (m StatsModel) apply(receipt *Receipt, sign int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	days, exists := m.tenants[receipt.Tenant]
+	if !exists {
+		days = make(map[string]map[string]*aggregate)
+		m.tenants[receipt.Tenant] = days
+	}
+
+	retailers, exists := days[receipt.PurchaseDate]
+	if !exists {
+		retailers = make(map[string]*aggregate)
+		days[receipt.PurchaseDate] = retailers
+	}
+
+	agg, exists := retailers[receipt.CanonicalRetailer()]
+	if !exists {
+		agg = newAggregate()
+		retailers[receipt.CanonicalRetailer()] = agg
+	}
+
+	agg.receipts += sign
+	agg.points += sign * int64(receipt.Points)
+	agg.spend = agg.spend.Add(receipt.Total.Decimal.Mul(decimal.NewFromInt(sign)))
+	agg.pointCounts[receipt.Points] += sign
+	if agg.pointCounts[receipt.Points] == 0 {
+		delete(agg.pointCounts, receipt.Points)
+	}
+
+	if agg.receipts == 0 {
+		delete(retailers, receipt.CanonicalRetailer())
+	}
+	if len(retailers) == 0 {
+		delete(days, receipt.PurchaseDate)
+	}
+	if len(days) == 0 {
+		delete(m.tenants, receipt.Tenant)
+	}
+}
+
+// Add records a newly stored receipt in the aggregates.
+func (m StatsModel) Add(receipt *Receipt) {
+	m.apply(receipt, 1)
+}
+
+// Remove takes a previously added receipt back out of the aggregates.
+func (m StatsModel) Remove(receipt *Receipt) {
+	m.apply(receipt, -1)
+}
+
+func groupKey(groupBy, date, retailer string) string {
+	switch groupBy {
+	case "retailer":
+		return retailer
+	case "month":
+		return date[:7]
+	case "week":
+		parsedDate, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return date
+		}
+		year, week := parsedDate.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return date
+	}
+}
+
+// Get returns the overall statistics for the tenant's receipts purchased within the
+// filter's date range, plus one entry per group when a grouping is requested.
+func (m StatsModel) Get(tenant string, f StatsFilters) (*Stats, []*StatsGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	total := newAggregate()
+	retailers := make(map[string]*aggregate)
+	groups := make(map[string]*aggregate)
+	groupRetailers := make(map[string]map[string]*aggregate)
+
+	for date, byRetailer := range m.tenants[tenant] {
+		if (f.From != "" && date < f.From) || (f.To != "" && date > f.To) {
+			continue
+		}
+
+		for retailer, agg := range byRetailer {
+			total.merge(agg)
+			mergeInto(retailers, retailer, agg)
+
+			if f.GroupBy != "" {
+				key := groupKey(f.GroupBy, date, retailer)
+				mergeInto(groups, key, agg)
+				if groupRetailers[key] == nil {
+					groupRetailers[key] = make(map[string]*aggregate)
+				}
+				mergeInto(groupRetailers[key], retailer, agg)
+			}
+		}
+	}
+
+	var grouped []*StatsGroup
+	for _, key := range slices.Sorted(maps.Keys(groups)) {
+		grouped = append(grouped, &StatsGroup{
+			Key:   key,
+			Stats: summarize(groups[key], groupRetailers[key], f.GroupBy != "retailer"),
+		})
+	}
+
+	return summarize(total, retailers, true), grouped, nil
+}
+
+func mergeInto(aggregates map[string]*aggregate, key string, agg *aggregate) {
+	target, exists := aggregates[key]
+	if !exists {
+		target = newAggregate()
+		aggregates[key] = target
+	}
+	target.merge(agg)
+}
+
+func summarize(agg *aggregate, retailers map[string]*aggregate, withRetailers bool) *Stats {
+	stats := &Stats{
+		Receipts:    agg.receipts,
+		TotalPoints: agg.points,
+		TotalSpend:  Price{agg.spend},
+	}
+	if agg.receipts == 0 {
+		return stats
+	}
+
+	stats.AveragePoints = math.Round(float64(agg.points)/float64(agg.receipts)*100) / 100
+	stats.MedianPoints = percentile(agg, 50)
+	stats.P95Points = percentile(agg, 95)
+
+	if withRetailers {
+		for retailer, retailerAgg := range retailers {
+			stats.TopRetailers = append(stats.TopRetailers, &RetailerStats{
+				Retailer: retailer,
+				Receipts: retailerAgg.receipts,
+				Points:   retailerAgg.points,
+				Spend:    Price{retailerAgg.spend},
+			})
+		}
+		slices.SortFunc(stats.TopRetailers, func(a, b *RetailerStats) int {
+			return cmp.Or(cmp.Compare(b.Points, a.Points), strings.Compare(a.Retailer, b.Retailer))
+		})
+		if len(stats.TopRetailers) > TopRetailersLimit {
+			stats.TopRetailers = stats.TopRetailers[:TopRetailersLimit]
+		}
+	}
+
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of the points awarded per receipt.
+func percentile(agg *aggregate, p float64) int32 {
+	rank := int64(math.Ceil(p / 100 * float64(agg.receipts)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for _, points := range slices.Sorted(maps.Keys(agg.pointCounts)) {
+		seen += agg.pointCounts[points]
+		if seen >= rank {
+			return points
+		}
+	}
+
+	return 0
+}
+
+// Handle keeps the aggregates in step with receipt events published on the EventBus.
+func (m StatsModel) Handle(event Event) error {
+	switch e := event.(type) {
+	case ReceiptCreated:
+		m.Add(&e.Receipt)
+	case ReceiptUpdated:
+		m.Remove(&e.Before)
+		m.Add(&e.After)
+	case ReceiptDeleted:
+		m.Remove(&e.Receipt)
+	}
+
+	return nil
+}
@@ -1,20 +1,125 @@
 package data
 
 import (
+	"github.com/google/uuid"
 	"sync"
+	"time"
 )
 
+// ReceiptStore is implemented by the in-memory ReceiptModel and by the event-sourced
+// EventSourcedReceiptModel.
+type ReceiptStore interface {
+	Insert(receipt *Receipt) error
+	GetAll(tenant string, filters ReceiptFilters) ([]*Receipt, error)
+	IDs(tenant string, filters ReceiptFilters) ([]uuid.UUID, error)
+	Get(tenant string, id uuid.UUID) (*Receipt, error)
+	Update(receipt *Receipt) error
+	Delete(tenant string, id uuid.UUID) (*Receipt, error)
+	Categories(tenant string) []string
+	Len() int
+}
+
 type Stores struct {
-	Receipts ReceiptModel
+	Receipts     ReceiptStore
+	Campaigns    CampaignModel
+	Retailers    RetailerModel
+	Stats        StatsModel
+	Leaderboards LeaderboardModel
+	Webhooks     WebhookModel
+	APIKeys      APIKeyModel
+	Quotas       QuotaModel
+	Ledger       LedgerModel
+	Events       *EventBus
 }
 
-func NewStores() Stores {
-	return Stores{
-		Receipts: ReceiptModel{
-			Store: make(map[string]Receipt),
-			mu:    &sync.RWMutex{},
+// NewStores creates the application's stores. When log is not nil, receipts are
+// event-sourced from it and the existing events are replayed before NewStores returns.
+func NewStores(categorizers Categorizers, quotas Quotas, expiration ExpirationPolicies, tiers Tiers, riskThreshold int, log *EventLog) (Stores, error) {
+	campaigns := CampaignModel{
+		Store: make(map[string]Campaign),
+		mu:    &sync.RWMutex{},
+	}
+	retailers := RetailerModel{
+		Store: make(map[string]Retailer),
+		index: &retailerIndex{names: make(map[string]*Retailer)},
+		mu:    &sync.RWMutex{},
+	}
+	stats := StatsModel{
+		tenants: make(map[string]map[string]map[string]*aggregate),
+		mu:      &sync.RWMutex{},
+	}
+	quotaModel := QuotaModel{
+		quotas: quotas,
+		usage:  make(map[string]*accountUsage),
+		mu:     &sync.Mutex{},
+	}
+	leaderboards := LeaderboardModel{
+		boards: make(map[string]*leaderboard),
+		mu:     &sync.Mutex{},
+	}
+
+	// Aggregates are maintained by subscribing to receipt events.
+	events := NewEventBus()
+	events.Subscribe("stats", stats.Handle)
+	events.Subscribe("leaderboards", leaderboards.Handle)
+
+	ledger := LedgerModel{
+		policies: expiration,
+		tiers:    tiers,
+		accounts: make(map[string]*accountLedger),
+		events:   events,
+		mu:       &sync.RWMutex{},
+	}
+
+	receipts := ReceiptModel{
+		Store:        make(map[string]Receipt),
+		mu:           &sync.RWMutex{},
+		campaigns:    campaigns,
+		retailers:    retailers,
+		categorizers: categorizers,
+		quotas:       quotaModel,
+		risk: RiskModel{
+			threshold:    riskThreshold,
+			fingerprints: make(map[string]int),
+			submissions:  make(map[string][]time.Time),
+			mu:           &sync.Mutex{},
 		},
+		ledger: ledger,
+		events: events,
 	}
+
+	str := Stores{
+		Receipts:     receipts,
+		Campaigns:    campaigns,
+		Retailers:    retailers,
+		Stats:        stats,
+		Leaderboards: leaderboards,
+		Webhooks: WebhookModel{
+			Store:       make(map[string]Webhook),
+			deliveries:  make(map[uuid.UUID][]Delivery),
+			deadLetters: make(map[uuid.UUID][]Delivery),
+			mu:          &sync.RWMutex{},
+		},
+		APIKeys: APIKeyModel{
+			Store:  make(map[string]APIKey),
+			byHash: make(map[string]uuid.UUID),
+			mu:     &sync.RWMutex{},
+		},
+		Quotas: quotaModel,
+		Ledger: ledger,
+		Events: events,
+	}
+
+	if log != nil {
+		es := EventSourcedReceiptModel{ReceiptModel: receipts, log: log}
+		err := es.load()
+		if err != nil {
+			return Stores{}, err
+		}
+		str.Receipts = es
+	}
+
+	return str, nil
 }
 
 //type Store struct {
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Tenant of callers and records that don't name one, and of every record created
+// before tenants were introduced.
+const DefaultTenant = "default"
+
+var TenantRX = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+func ValidateTenant(v *validator.Validator, tenant string) {
+	v.Check(validator.Matches(tenant, TenantRX), "tenant", "must be 1-63 lowercase letters, digits, '-' or '_'")
+}
+
+// TenantOrDefault returns tenant, or DefaultTenant when it is empty.
+func TenantOrDefault(tenant string) string {
+	if tenant == "" {
+		return DefaultTenant
+	}
+
+	return tenant
+}
+
+// TenantConfig is the configuration of one tenant in a tenants file. Categories names a
+// category rules file replacing the default rules for the tenant's receipts, and Tiers a
+// tier rules file replacing the default loyalty tiers, both relative to the tenants
+// file. Quotas replaces the default daily quotas of the tenant's
+// accounts, and Expiration the default expiration policy of their points.
+type TenantConfig struct {
+	Categories string            `json:"categories,omitempty"`
+	Tiers      string            `json:"tiers,omitempty"`
+	Quotas     *QuotaLimits      `json:"quotas,omitempty"`
+	Expiration *ExpirationPolicy `json:"expiration,omitempty"`
+}
+
+// LoadTenants reads a JSON object mapping tenant names to their TenantConfig.
+func LoadTenants(path string) (map[string]TenantConfig, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants map[string]TenantConfig
+	err = json.Unmarshal(file, &tenants)
+	if err != nil {
+		return nil, fmt.Errorf("tenants %s: %w", path, err)
+	}
+
+	for name, tenant := range tenants {
+		if !validator.Matches(name, TenantRX) {
+			return nil, fmt.Errorf("tenants %s: invalid tenant name %q", path, name)
+		}
+		if tenant.Quotas != nil {
+			v := validator.New()
+			if ValidateQuotaLimits(v, *tenant.Quotas); !v.Valid() {
+				return nil, fmt.Errorf("tenants %s: tenant %q: invalid quotas: %v", path, name, v.Errors)
+			}
+		}
+		if tenant.Expiration != nil {
+			v := validator.New()
+			if ValidateExpirationPolicy(v, *tenant.Expiration); !v.Valid() {
+				return nil, fmt.Errorf("tenants %s: tenant %q: invalid expiration policy: %v", path, name, v.Errors)
+			}
+		}
+		if tenant.Categories != "" && !filepath.IsAbs(tenant.Categories) {
+			tenant.Categories = filepath.Join(filepath.Dir(path), tenant.Categories)
+		}
+		if tenant.Tiers != "" && !filepath.IsAbs(tenant.Tiers) {
+			tenant.Tiers = filepath.Join(filepath.Dir(path), tenant.Tiers)
+		}
+		tenants[name] = tenant
+	}
+
+	return tenants, nil
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/shopspring/decimal"
+	"os"
+	"slices"
+)
+
+const (
+	TierBronze = "bronze"
+	TierSilver = "silver"
+	TierGold   = "gold"
+
+	// Tiers are computed from the points an account earned over this many months.
+	tierWindowMonths = 12
+)
+
+// Tier is a loyalty tier, reached by accounts that earned at least MinPoints over the
+// last 12 months. The points CalculatePoints awards the receipts of accounts in the
+// tier are multiplied by Multiplier, and Bonus is added on top.
+type Tier struct {
+	Name       string          `json:"name"`
+	MinPoints  int64           `json:"minPoints"`
+	Multiplier decimal.Decimal `json:"multiplier"`
+	Bonus      int32           `json:"bonus,omitempty"`
+}
+
+func DefaultTiers() []Tier {
+	return []Tier{
+		{Name: TierBronze, MinPoints: 0, Multiplier: decimal.NewFromInt(1)},
+		{Name: TierSilver, MinPoints: 1000, Multiplier: decimal.RequireFromString("1.1")},
+		{Name: TierGold, MinPoints: 5000, Multiplier: decimal.RequireFromString("1.25"), Bonus: 10},
+	}
+}
+
+// LoadTiers reads a JSON array of Tier values, lowest tier first, from the given file.
+func LoadTiers(path string) ([]Tier, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tiers []Tier
+	err = json.Unmarshal(file, &tiers)
+	if err != nil {
+		return nil, fmt.Errorf("tier rules %s: %w", path, err)
+	}
+
+	v := validator.New()
+	if ValidateTiers(v, tiers); !v.Valid() {
+		return nil, fmt.Errorf("tier rules %s: %v", path, v.Errors)
+	}
+
+	return tiers, nil
+}
+
+// ValidateTiers checks that tiers start at zero points and go up from there, and that
+// no tier takes points away.
+func ValidateTiers(v *validator.Validator, tiers []Tier) {
+	v.Check(len(tiers) > 0, "tiers", "must contain at least one tier")
+	v.Check(len(tiers) == 0 || tiers[0].MinPoints == 0, "tiers", "must start with a tier with minPoints 0")
+
+	names := make([]string, len(tiers))
+	for i, tier := range tiers {
+		names[i] = tier.Name
+		v.Check(tier.Name != "", "name", "must be provided")
+		v.Check(i == 0 || tier.MinPoints > tiers[i-1].MinPoints, "minPoints", "must increase from one tier to the next")
+		v.Check(tier.Multiplier.GreaterThanOrEqual(decimal.NewFromInt(1)), "multiplier", "must be at least 1")
+		v.Check(tier.Bonus >= 0, "bonus", "must not be negative")
+	}
+	v.Check(validator.Unique(names), "name", "must be unique")
+}
+
+// Tiers holds the tiers of the tenants that have their own, and the default tiers used
+// by every other tenant.
+type Tiers struct {
+	Default []Tier
+	Tenants map[string][]Tier
+}
+
+// For returns the tenant's tiers, lowest first.
+func (t Tiers) For(tenant string) []Tier {
+	if tiers, exists := t.Tenants[tenant]; exists {
+		return tiers
+	}
+
+	return t.Default
+}
+
+// tierFor() returns the highest of the tiers reached with the points earned.
+func tierFor(tiers []Tier, earned int64) Tier {
+	i := slices.IndexFunc(tiers, func(t Tier) bool { return t.MinPoints > earned })
+	switch i {
+	case -1:
+		return tiers[len(tiers)-1]
+	case 0:
+		return tiers[0]
+	default:
+		return tiers[i-1]
+	}
+}
+
+// ApplyTier adds the tier's multiplier and bonus on top of the points already in the
+// calculator, recording both in a single 'tier' line of the points breakdown.
+func ApplyTier(c *Calculator, tier Tier) {
+	bonus := decimal.NewFromInt32(c.TotalPoints()).Mul(tier.Multiplier.Sub(decimal.NewFromInt(int64(DecimalValue))))
+	points := int32(bonus.Round(ZeroValue).IntPart()) + tier.Bonus
+
+	multiplier := tier.Multiplier
+	c.AddLine(PointsLine{Rule: RuleTier, Points: points, Tier: tier.Name, Multiplier: &multiplier})
+}
+
+// tierNamed() returns the tier with the given name, if it is still configured.
+func tierNamed(tiers []Tier, name string) (Tier, bool) {
+	i := slices.IndexFunc(tiers, func(t Tier) bool { return t.Name == name })
+	if i < 0 {
+		return Tier{}, false
+	}
+	return tiers[i], true
+}
+
+// tierLine() returns the tier line of the receipt's points breakdown, or nil when the
+// receipt wasn't scored in a tier.
+func (r *Receipt) tierLine() *PointsLine {
+	i := slices.IndexFunc(r.Breakdown, func(l PointsLine) bool { return l.Rule == RuleTier })
+	if i < 0 {
+		return nil
+	}
+	return &r.Breakdown[i]
+}
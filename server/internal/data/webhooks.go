@@ -0,0 +1,239 @@
+package data
+
+import (
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"github.com/google/uuid"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventReceiptProcessed = "receipt.processed"
+	EventReceiptUpdated   = "receipt.updated"
+	EventReceiptDeleted   = "receipt.deleted"
+	EventTierChanged      = "account.tier_changed"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+
+	// Number of deliveries kept per webhook in the delivery log and dead-letter list.
+	deliveryLogLimit = 100
+)
+
+var WebhookEvents = []string{EventReceiptProcessed, EventReceiptUpdated, EventReceiptDeleted, EventTierChanged}
+
+// Shared address space used by carrier-grade NAT, which netip doesn't count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Tenant    string    `json:"tenant"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Version   int32     `json:"version"`
+}
+
+// Delivery records the attempts to deliver one event to one webhook.
+type Delivery struct {
+	ID             uuid.UUID `json:"id"`
+	WebhookID      uuid.UUID `json:"webhookId"`
+	Event          string    `json:"event"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	ResponseStatus int       `json:"responseStatus,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// WebhookAddrAllowed reports whether webhooks may be delivered to the address. Loopback,
+// private, link-local and other non-public addresses are refused so that a webhook can't
+// be used to reach the server's own network or the cloud metadata endpoint.
+func WebhookAddrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// ValidateWebhook checks the webhook's URL and subscriptions. Hosts given as an address
+// are checked with WebhookAddrAllowed here, while host names are checked once they are
+// resolved, when a delivery connects.
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	u, err := url.Parse(webhook.URL)
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	if err == nil && u.Host != "" {
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		addr, aerr := netip.ParseAddr(host)
+		local := host == "localhost" || strings.HasSuffix(host, ".localhost")
+		v.Check(!local && (aerr != nil || WebhookAddrAllowed(addr)), "url", "must not point to a loopback, private or link-local address")
+	}
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least one event")
+	for _, event := range webhook.Events {
+		v.Check(validator.PermittedValue(event, WebhookEvents...), "events", "must only contain receipt.processed, receipt.updated, receipt.deleted or account.tier_changed")
+	}
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+}
+
+type WebhookModel struct {
+	Store       map[string]Webhook
+	deliveries  map[uuid.UUID][]Delivery
+	deadLetters map[uuid.UUID][]Delivery
+	mu          *sync.RWMutex
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook.ID = uuid.New()
+	webhook.CreatedAt = time.Now()
+	webhook.Version = 1
+
+	m.Store[webhook.ID.String()] = *webhook
+	return nil
+}
+
+func (m WebhookModel) GetAll(tenant string) ([]*Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := make([]*Webhook, 0, len(m.Store))
+	for _, webhook := range m.Store {
+		if webhook.Tenant == tenant {
+			webhooks = append(webhooks, &webhook)
+		}
+	}
+	slices.SortFunc(webhooks, func(a, b *Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return webhooks, nil
+}
+
+func (m WebhookModel) Get(tenant string, id uuid.UUID) (*Webhook, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhook, exists := m.Store[id.String()]
+	if !exists || webhook.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	return &webhook, nil
+}
+
+func (m WebhookModel) Update(webhook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, exists := m.Store[webhook.ID.String()]
+	if !exists || stored.Tenant != webhook.Tenant {
+		return ErrRecordNotFound
+	}
+	if stored.Version != webhook.Version {
+		return ErrEditConflict
+	}
+
+	webhook.Version += 1
+	m.Store[webhook.ID.String()] = *webhook
+	return nil
+}
+
+// Delete removes a webhook along with its delivery log and returns it as it was
+// stored.
+func (m WebhookModel) Delete(tenant string, id uuid.UUID) (*Webhook, error) {
+	if id == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, exists := m.Store[id.String()]
+	if !exists || webhook.Tenant != tenant {
+		return nil, ErrRecordNotFound
+	}
+
+	delete(m.Store, id.String())
+	delete(m.deliveries, id)
+	delete(m.deadLetters, id)
+	return &webhook, nil
+}
+
+// Subscribers returns the tenant's active webhooks subscribed to the event.
+func (m WebhookModel) Subscribers(tenant, event string) []*Webhook {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var webhooks []*Webhook
+	for _, webhook := range m.Store {
+		if webhook.Tenant == tenant && webhook.Active && slices.Contains(webhook.Events, event) {
+			webhooks = append(webhooks, &webhook)
+		}
+	}
+
+	return webhooks
+}
+
+// RecordDelivery adds or updates a delivery in its webhook's delivery log, and moves it
+// to the dead-letter list once it is dead. Both are capped to the most recent entries.
+func (m WebhookModel) RecordDelivery(delivery Delivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.Store[delivery.WebhookID.String()]; !exists {
+		return
+	}
+
+	log := m.deliveries[delivery.WebhookID]
+	i := slices.IndexFunc(log, func(d Delivery) bool { return d.ID == delivery.ID })
+	if i >= 0 {
+		log[i] = delivery
+	} else {
+		log = append(log, delivery)
+		if len(log) > deliveryLogLimit {
+			log = slices.Delete(log, 0, len(log)-deliveryLogLimit)
+		}
+	}
+	m.deliveries[delivery.WebhookID] = log
+
+	if delivery.Status == DeliveryDead {
+		dead := append(m.deadLetters[delivery.WebhookID], delivery)
+		if len(dead) > deliveryLogLimit {
+			dead = slices.Delete(dead, 0, len(dead)-deliveryLogLimit)
+		}
+		m.deadLetters[delivery.WebhookID] = dead
+	}
+}
+
+// Deliveries returns the webhook's delivery log, most recent first.
+func (m WebhookModel) Deliveries(id uuid.UUID) []Delivery {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := slices.Clone(m.deliveries[id])
+	slices.Reverse(deliveries)
+	return deliveries
+}
+
+// DeadLetters returns the webhook's deliveries that exhausted their retries, most
+// recent first.
+func (m WebhookModel) DeadLetters(id uuid.UUID) []Delivery {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dead := slices.Clone(m.deadLetters[id])
+	slices.Reverse(dead)
+	return dead
+}
@@ -0,0 +1,328 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/validator"
+	"io"
+	"strings"
+)
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+
+	// Number of records processed between progress reports.
+	ProgressInterval = 1000
+	// Longest NDJSON line accepted, matching the limit on a single processed receipt.
+	maxLineBytes = 1_048_576
+)
+
+var csvRequiredColumns = []string{"retailer", "purchaseDate", "purchaseTime", "total", "itemShortDescription", "itemPrice"}
+
+// ValidationError carries per-field validation messages for a rejected record. An
+// Inserter returns it when the destination refuses a receipt as invalid, so the record
+// is written to the rejects rather than aborting the import.
+type ValidationError map[string]string
+
+func (e ValidationError) Error() string {
+	return "receipt failed validation"
+}
+
+type Inserter interface {
+	Insert(receipt *data.Receipt) error
+}
+
+type Options struct {
+	// Format of the input, either FormatNDJSON or FormatCSV.
+	Format string
+	// Offset skips records starting on or before this line, so an import that failed
+	// can be resumed from the Line reported in its Summary.
+	Offset int
+	// OnReject, when set, is called with each record that failed validation.
+	OnReject func(Reject) error
+	// Progress, when set, is called every ProgressInterval records.
+	Progress func(Summary)
+}
+
+type Summary struct {
+	Line     int `json:"line"`
+	Inserted int `json:"inserted"`
+	Rejected int `json:"rejected"`
+	Skipped  int `json:"skipped"`
+}
+
+type Reject struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+type receiptInput struct {
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate"`
+	PurchaseTime string `json:"purchaseTime"`
+	Items        []struct {
+		ShortDescription string     `json:"shortDescription"`
+		Price            data.Price `json:"price"`
+	} `json:"items"`
+	Total data.Price `json:"total"`
+}
+
+// record is a single receipt read from the input, or the reason it couldn't be read.
+type record struct {
+	line    int
+	receipt *data.Receipt
+	err     error
+}
+
+// Run streams receipts from r, validates each with data.ValidateReceipt and inserts the
+// valid ones. Invalid records are passed to opts.OnReject and the import carries on;
+// a read or insert failure stops it, and the returned Summary's Line is the offset to
+// resume from.
+func Run(r io.Reader, dst Inserter, opts Options) (Summary, error) {
+	var summary Summary
+	next, err := newReader(r, opts.Format)
+	if err != nil {
+		return summary, err
+	}
+
+	for {
+		rec, err := next()
+		if errors.Is(err, io.EOF) {
+			return summary, nil
+		}
+		if err != nil {
+			return summary, err
+		}
+
+		if rec.line <= opts.Offset {
+			summary.Skipped++
+			summary.Line = rec.line
+			continue
+		}
+
+		err = importRecord(rec, dst)
+		var verr ValidationError
+		switch {
+		case errors.As(err, &verr):
+			summary.Rejected++
+			if opts.OnReject != nil {
+				if err := opts.OnReject(Reject{Line: rec.line, Errors: verr}); err != nil {
+					return summary, err
+				}
+			}
+		case err != nil:
+			return summary, fmt.Errorf("line %d: %w", rec.line, err)
+		default:
+			summary.Inserted++
+		}
+		summary.Line = rec.line
+
+		if opts.Progress != nil && (summary.Inserted+summary.Rejected)%ProgressInterval == 0 {
+			opts.Progress(summary)
+		}
+	}
+}
+
+func importRecord(rec record, dst Inserter) error {
+	if rec.err != nil {
+		return ValidationError{"record": rec.err.Error()}
+	}
+
+	v := validator.New()
+	if data.ValidateReceipt(v, rec.receipt); !v.Valid() {
+		return ValidationError(v.Errors)
+	}
+
+	return dst.Insert(rec.receipt)
+}
+
+func newReader(r io.Reader, format string) (func() (record, error), error) {
+	switch format {
+	case FormatNDJSON:
+		return ndjsonReader(r), nil
+	case FormatCSV:
+		return csvReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+func ndjsonReader(r io.Reader) func() (record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	line := 0
+
+	return func() (record, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var input receiptInput
+			err := json.Unmarshal([]byte(text), &input)
+			if err != nil {
+				return record{line: line, err: err}, nil
+			}
+
+			return record{line: line, receipt: input.receipt()}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return record{}, err
+		}
+
+		return record{}, io.EOF
+	}
+}
+
+// csvReader reads receipts flattened one item per row, as written by the receipt
+// export. Consecutive rows belong to the same receipt while their id column (or, when
+// there is no id, their receipt columns) stay the same.
+func csvReader(r io.Reader) (func() (record, error), error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvRequiredColumns {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("csv header is missing the %q column", name)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, exists := columns[name]
+		if !exists || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+	key := func(row []string) string {
+		if id := field(row, "id"); id != "" {
+			return id
+		}
+		return strings.Join([]string{field(row, "retailer"), field(row, "purchaseDate"), field(row, "purchaseTime"), field(row, "total")}, "\x00")
+	}
+
+	line := 1
+	var pending []string
+	pendingLine := 0
+
+	return func() (record, error) {
+		var current *data.Receipt
+		var currentErr error
+		var currentKey string
+		start := 0
+
+		if pending != nil {
+			current, currentErr = csvReceipt(pending, field)
+			currentKey, start = key(pending), pendingLine
+			pending = nil
+		}
+
+		for {
+			row, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				if current == nil && currentErr == nil {
+					return record{}, io.EOF
+				}
+				return record{line: start, receipt: current, err: currentErr}, nil
+			}
+			line++
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				if current == nil && currentErr == nil {
+					return record{line: line, err: err}, nil
+				}
+				currentErr = err
+				continue
+			}
+			if err != nil {
+				return record{}, err
+			}
+
+			if current == nil && currentErr == nil {
+				current, currentErr = csvReceipt(row, field)
+				currentKey, start = key(row), line
+				continue
+			}
+
+			if key(row) != currentKey {
+				pending, pendingLine = row, line
+				return record{line: start, receipt: current, err: currentErr}, nil
+			}
+
+			if currentErr == nil {
+				currentErr = csvAddItem(current, row, field)
+			}
+		}
+	}, nil
+}
+
+func csvReceipt(row []string, field func([]string, string) string) (*data.Receipt, error) {
+	receipt := &data.Receipt{
+		Retailer:     field(row, "retailer"),
+		PurchaseDate: field(row, "purchaseDate"),
+		PurchaseTime: field(row, "purchaseTime"),
+		Items:        []data.Item{},
+	}
+
+	err := receipt.Total.UnmarshalJSON([]byte(fmt.Sprintf("%q", field(row, "total"))))
+	if err != nil {
+		return nil, fmt.Errorf("total: %w", err)
+	}
+
+	return receipt, csvAddItem(receipt, row, field)
+}
+
+func csvAddItem(receipt *data.Receipt, row []string, field func([]string, string) string) error {
+	description := field(row, "itemShortDescription")
+	price := field(row, "itemPrice")
+	if description == "" && price == "" {
+		return nil
+	}
+
+	item := data.Item{ShortDescription: description}
+	err := item.Price.UnmarshalJSON([]byte(fmt.Sprintf("%q", price)))
+	if err != nil {
+		return fmt.Errorf("itemPrice: %w", err)
+	}
+	receipt.Items = append(receipt.Items, item)
+
+	return nil
+}
+
+func (input receiptInput) receipt() *data.Receipt {
+	var items []data.Item
+	if input.Items != nil {
+		items = make([]data.Item, len(input.Items))
+	}
+	for i, item := range input.Items {
+		items[i] = data.Item{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+		}
+	}
+
+	return &data.Receipt{
+		Retailer:     input.Retailer,
+		PurchaseDate: input.PurchaseDate,
+		PurchaseTime: input.PurchaseTime,
+		Items:        items,
+		Total:        input.Total,
+	}
+}
@@ -0,0 +1,338 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+
+	// Clock skew tolerated when checking the exp and nbf claims.
+	leeway = time.Minute
+)
+
+var (
+	ErrMalformed   = errors.New("malformed token")
+	ErrUnknownKey  = errors.New("no key matches the token's algorithm and key id")
+	ErrSignature   = errors.New("invalid token signature")
+	ErrExpired     = errors.New("token has expired")
+	ErrNotYetValid = errors.New("token is not valid yet")
+	ErrClaims      = errors.New("token claims are not acceptable")
+)
+
+// Audience is the 'aud' claim, which may be a single string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// Claims holds the registered claims this service checks and the custom claims it maps
+// into the request context. Scopes may be given as a space-separated 'scope' claim, as a
+// 'scopes' array, or both.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+	Tenant    string   `json:"tenant"`
+	Scope     string   `json:"scope"`
+	Scopes    []string `json:"scopes"`
+}
+
+// ScopeList returns the scopes granted by the 'scope' and 'scopes' claims combined.
+func (c *Claims) ScopeList() []string {
+	scopes := slices.Clone(c.Scopes)
+	for _, scope := range strings.Fields(c.Scope) {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+// Key is a verification key for one algorithm. A Key with an ID only verifies tokens
+// whose header names the same 'kid'.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	rsaKey    *rsa.PublicKey
+	ecKey     *ecdsa.PublicKey
+}
+
+// NewHMACKey returns an HS256 key for a shared secret.
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Algorithm: HS256, secret: secret}
+}
+
+// ParsePublicKeyPEM returns an RS256 or ES256 key for a PEM-encoded RSA or P-256 public
+// key (PKIX 'PUBLIC KEY' block).
+func ParsePublicKeyPEM(id string, b []byte) (Key, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return Key{}, errors.New("no PEM block found")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{ID: id, Algorithm: RS256, rsaKey: pub}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return Key{}, errors.New("only P-256 EC keys are supported")
+		}
+		return Key{ID: id, Algorithm: ES256, ecKey: pub}, nil
+	default:
+		return Key{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// LoadPublicKeyPEM reads a PEM-encoded public key file.
+func LoadPublicKeyPEM(path string) (Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	key, err := ParsePublicKeyPEM("", b)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS reads the signing keys of a JSON Web Key Set file. Keys meant for encryption
+// and key types other than oct, RSA and EC P-256 are skipped.
+func LoadJWKS(path string) ([]Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = json.Unmarshal(b, &set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var keys []Key
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, ok, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %d: %w", path, i, err)
+		}
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no supported signing keys", path)
+	}
+	return keys, nil
+}
+
+// key converts a JWK to a Key, reporting false for key types that aren't supported.
+func (k jwk) key() (Key, bool, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch {
+	case k.Kty == "oct" && (k.Alg == "" || k.Alg == HS256):
+		secret, err := decode(k.K)
+		if err != nil || len(secret) == 0 {
+			return Key{}, false, errors.New("invalid 'k'")
+		}
+		return NewHMACKey(k.Kid, secret), true, nil
+
+	case k.Kty == "RSA" && (k.Alg == "" || k.Alg == RS256):
+		n, err := decode(k.N)
+		if err != nil || len(n) == 0 {
+			return Key{}, false, errors.New("invalid 'n'")
+		}
+		e, err := decode(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return Key{}, false, errors.New("invalid 'e'")
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return Key{ID: k.Kid, Algorithm: RS256, rsaKey: pub}, true, nil
+
+	case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == ES256):
+		x, errX := decode(k.X)
+		y, errY := decode(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return Key{}, false, errors.New("invalid 'x' or 'y'")
+		}
+		// crypto/ecdh rejects points that aren't on the curve.
+		_, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return Key{}, false, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		return Key{ID: k.Kid, Algorithm: ES256, ecKey: pub}, true, nil
+	}
+
+	return Key{}, false, nil
+}
+
+// verify checks sig over signed with the key.
+func (k Key) verify(signed string, sig []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(sig, mac.Sum(nil))
+	case RS256:
+		return rsa.VerifyPKCS1v15(k.rsaKey, crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k.ecKey, digest[:], r, s)
+	}
+
+	return false
+}
+
+// Verifier validates tokens against a fixed set of keys. When Issuer or Audience are set
+// the token's 'iss' claim must equal Issuer and its 'aud' claim must contain Audience.
+type Verifier struct {
+	keys     []Key
+	Issuer   string
+	Audience string
+}
+
+func NewVerifier(keys []Key, issuer, audience string) *Verifier {
+	return &Verifier{keys: keys, Issuer: issuer, Audience: audience}
+}
+
+// Verify checks the token's signature and time claims and returns its claims. The
+// algorithm in the token header only selects among the configured keys, so a token can
+// never pick a weaker algorithm (or 'none') than the key it is verified with.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(b, &header) != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	signed := parts[0] + "." + parts[1]
+	matched, verified := false, false
+	for _, key := range v.keys {
+		if key.Algorithm != header.Alg || (header.Kid != "" && key.ID != "" && key.ID != header.Kid) {
+			continue
+		}
+		matched = true
+		if key.verify(signed, sig) {
+			verified = true
+			break
+		}
+	}
+	switch {
+	case !matched:
+		return nil, ErrUnknownKey
+	case !verified:
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+	b, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(b, &claims) != nil {
+		return nil, ErrMalformed
+	}
+
+	now := time.Now()
+	switch {
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)):
+		return nil, ErrExpired
+	case claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-leeway)):
+		return nil, ErrNotYetValid
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: 'sub' must be provided", ErrClaims)
+	case v.Issuer != "" && claims.Issuer != v.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrClaims)
+	case v.Audience != "" && !slices.Contains(claims.Audience, v.Audience):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrClaims)
+	}
+
+	return &claims, nil
+}
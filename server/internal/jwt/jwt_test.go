@@ -0,0 +1,214 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("jwt-test-secret-jwt-test-secret!")
+
+// sign() builds a token with the given header and claims, signed by signer over
+// "<header>.<claims>".
+func sign(t *testing.T, header, claims map[string]any, signer func(signed string) []byte) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signer(signed))
+}
+
+func hmacSigner(secret []byte) func(string) []byte {
+	return func(signed string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+}
+
+func rsaSigner(t *testing.T, key *rsa.PrivateKey) func(string) []byte {
+	return func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+}
+
+// validClaims() returns claims every test verifier accepts, with the given overrides.
+func validClaims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"sub":    "user-1",
+		"iss":    "https://issuer.test",
+		"aud":    "receipts",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"tenant": "acme",
+		"scope":  "receipts:read",
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	rsaPublic, err := ParsePublicKeyPEM("rsa-1", rsaPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmacVerifier := NewVerifier([]Key{NewHMACKey("hmac-1", testSecret)}, "https://issuer.test", "receipts")
+	rsaVerifier := NewVerifier([]Key{rsaPublic}, "https://issuer.test", "receipts")
+
+	hs256 := map[string]any{"alg": HS256, "typ": "JWT", "kid": "hmac-1"}
+	rs256 := map[string]any{"alg": RS256, "typ": "JWT", "kid": "rsa-1"}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		wantErr  error
+	}{
+		{
+			name:     "valid HS256",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(nil), hmacSigner(testSecret)),
+		},
+		{
+			name:     "valid RS256",
+			verifier: rsaVerifier,
+			token:    sign(t, rs256, validClaims(nil), rsaSigner(t, rsaKey)),
+		},
+		{
+			name:     "HS256 signed with the RSA public key",
+			verifier: rsaVerifier,
+			token:    sign(t, map[string]any{"alg": HS256, "kid": "rsa-1"}, validClaims(nil), hmacSigner(rsaPEM)),
+			wantErr:  ErrUnknownKey,
+		},
+		{
+			name:     "alg none",
+			verifier: hmacVerifier,
+			token:    sign(t, map[string]any{"alg": "none"}, validClaims(nil), func(string) []byte { return nil }),
+			wantErr:  ErrUnknownKey,
+		},
+		{
+			name:     "wrong secret",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(nil), hmacSigner([]byte("another-secret-another-secret!!!"))),
+			wantErr:  ErrSignature,
+		},
+		{
+			name:     "unknown kid",
+			verifier: hmacVerifier,
+			token:    sign(t, map[string]any{"alg": HS256, "kid": "hmac-2"}, validClaims(nil), hmacSigner(testSecret)),
+			wantErr:  ErrUnknownKey,
+		},
+		{
+			name:     "missing kid is tried against every key of the algorithm",
+			verifier: hmacVerifier,
+			token:    sign(t, map[string]any{"alg": HS256}, validClaims(nil), hmacSigner(testSecret)),
+		},
+		{
+			name:     "missing exp",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"exp": nil}), hmacSigner(testSecret)),
+			wantErr:  ErrExpired,
+		},
+		{
+			name:     "expired within leeway",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"exp": now.Add(-leeway / 2).Unix()}), hmacSigner(testSecret)),
+		},
+		{
+			name:     "expired beyond leeway",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"exp": now.Add(-2 * leeway).Unix()}), hmacSigner(testSecret)),
+			wantErr:  ErrExpired,
+		},
+		{
+			name:     "not yet valid within leeway",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"nbf": now.Add(leeway / 2).Unix()}), hmacSigner(testSecret)),
+		},
+		{
+			name:     "not yet valid beyond leeway",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"nbf": now.Add(2 * leeway).Unix()}), hmacSigner(testSecret)),
+			wantErr:  ErrNotYetValid,
+		},
+		{
+			name:     "audience in an array",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"aud": []string{"billing", "receipts"}}), hmacSigner(testSecret)),
+		},
+		{
+			name:     "audience mismatch",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"aud": "billing"}), hmacSigner(testSecret)),
+			wantErr:  ErrClaims,
+		},
+		{
+			name:     "issuer mismatch",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"iss": "https://evil.test"}), hmacSigner(testSecret)),
+			wantErr:  ErrClaims,
+		},
+		{
+			name:     "missing subject",
+			verifier: hmacVerifier,
+			token:    sign(t, hs256, validClaims(map[string]any{"sub": nil}), hmacSigner(testSecret)),
+			wantErr:  ErrClaims,
+		},
+		{
+			name:     "malformed",
+			verifier: hmacVerifier,
+			token:    "not-a-token",
+			wantErr:  ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (claims.Subject != "user-1" || claims.Tenant != "acme") {
+				t.Errorf("Verify() claims = %+v; want subject user-1 of tenant acme", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds, suited to requests served from memory.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics in the order they were registered, which is also the order
+// they are written in.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	collect []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.metrics = append(reg.metrics, m)
+}
+
+// OnCollect registers fn to be called once at the start of every WriteTo, before any
+// metric is written, so that func metrics reporting parts of the same reading only take
+// it once per scrape.
+func (reg *Registry) OnCollect(fn func()) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.collect = append(reg.collect, fn)
+}
+
+// WriteTo writes every registered metric to w.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.mu.Lock()
+	metrics := slices.Clone(reg.metrics)
+	collect := slices.Clone(reg.collect)
+	reg.mu.Unlock()
+
+	for _, fn := range collect {
+		fn()
+	}
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// series is the label values of one time series, kept alongside the key it is stored
+// under so output can be sorted.
+type series struct {
+	key    string
+	values []string
+}
+
+func seriesKey(labels, values []string) string {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(labels)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// header writes the HELP and TYPE lines of a metric.
+func header(w *bufio.Writer, name, help, typ string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample line. Extra is a label added after the metric's own, such
+// as a histogram's 'le'.
+func sample(w *bufio.Writer, name string, labels, values []string, extra, extraValue string, v float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 || extra != "" {
+		w.WriteByte('{')
+		escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, escape.Replace(values[i]))
+		}
+		if extra != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extra, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*series
+	values map[string]float64
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*series),
+		values: make(map[string]float64),
+	}
+	reg.register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := seriesKey(c.labels, values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.series[key]; !exists {
+		c.series[key] = &series{key: key, values: slices.Clone(values)}
+	}
+	c.values[key] += v
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header(w, c.name, c.help, "counter")
+	for _, s := range sortedSeries(c.series) {
+		sample(w, c.name, c.labels, s.values, "", "", c.values[s.key])
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*series
+	counts  map[string][]uint64
+	sums    map[string]float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds, in
+// increasing order, and label names. The +Inf bucket is added implicitly.
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: slices.Clone(buckets),
+		series:  make(map[string]*series),
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+	}
+	reg.register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := seriesKey(h.labels, values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts, exists := h.counts[key]
+	if !exists {
+		h.series[key] = &series{key: key, values: slices.Clone(values)}
+		counts = make([]uint64, len(h.buckets)+1)
+		h.counts[key] = counts
+	}
+
+	// Counts are kept per bucket and made cumulative when written.
+	i, _ := slices.BinarySearch(h.buckets, v)
+	counts[i]++
+	h.sums[key] += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	header(w, h.name, h.help, "histogram")
+	for _, s := range sortedSeries(h.series) {
+		var cumulative uint64
+		for i, count := range h.counts[s.key] {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			sample(w, h.name+"_bucket", h.labels, s.values, "le", formatFloat(le), float64(cumulative))
+		}
+		sample(w, h.name+"_sum", h.labels, s.values, "", "", h.sums[s.key])
+		sample(w, h.name+"_count", h.labels, s.values, "", "", float64(cumulative))
+	}
+}
+
+// GaugeFunc is a gauge whose value is read from a function every time it is written.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge reporting the value returned by fn.
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	reg.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	header(w, g.name, g.help, "gauge")
+	sample(w, g.name, nil, nil, "", "", g.fn())
+}
+
+// CounterFunc is a counter whose value is read from a function every time it is
+// written, for counts kept elsewhere such as the Go runtime's.
+type CounterFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewCounterFunc registers a counter reporting the value returned by fn.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	c := &CounterFunc{name: name, help: help, fn: fn}
+	reg.register(c)
+	return c
+}
+
+func (c *CounterFunc) write(w *bufio.Writer) {
+	header(w, c.name, c.help, "counter")
+	sample(w, c.name, nil, nil, "", "", c.fn())
+}
+
+func sortedSeries(m map[string]*series) []*series {
+	all := make([]*series, 0, len(m))
+	for _, s := range m {
+		all = append(all, s)
+	}
+	slices.SortFunc(all, func(a, b *series) int {
+		return strings.Compare(a.key, b.key)
+	})
+	return all
+}
@@ -0,0 +1,322 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Avixph/receipt-processor-challenge/server/internal/data"
+	"github.com/shopspring/decimal"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Number of leading lines searched for the store header when picking a layout.
+const headerLines = 5
+
+// Layout describes how a retailer's plain-text receipts are laid out. Patterns are
+// regular expressions using named groups: 'desc' and 'price' for item lines, 'total'
+// for the total line, 'date' and 'time' for the purchase date and time.
+type Layout struct {
+	Name            string   `json:"name"`
+	Retailer        string   `json:"retailer,omitempty"`
+	RetailerPattern string   `json:"retailerPattern,omitempty"`
+	ItemPattern     string   `json:"itemPattern"`
+	TotalPattern    string   `json:"totalPattern"`
+	DatePattern     string   `json:"datePattern"`
+	DateLayouts     []string `json:"dateLayouts"`
+	TimePattern     string   `json:"timePattern"`
+	TimeLayouts     []string `json:"timeLayouts"`
+	IgnorePatterns  []string `json:"ignorePatterns,omitempty"`
+}
+
+type layout struct {
+	Layout
+	retailerRX *regexp.Regexp
+	itemRX     *regexp.Regexp
+	totalRX    *regexp.Regexp
+	dateRX     *regexp.Regexp
+	timeRX     *regexp.Regexp
+	ignoreRX   []*regexp.Regexp
+}
+
+type Parser struct {
+	layouts []*layout
+	generic *layout
+}
+
+// Result is a receipt parsed from plain text, along with how confident the parser is
+// in it and the lines it couldn't make sense of.
+type Result struct {
+	Receipt    *data.Receipt `json:"-"`
+	Layout     string        `json:"layout"`
+	Confidence float64       `json:"confidence"`
+	Unparsed   []string      `json:"unparsed"`
+}
+
+// GenericLayout matches the common "DESCRIPTION   PRICE" layout with a "TOTAL" line
+// and a date/time footer, and is used when no retailer layout matches.
+func GenericLayout() Layout {
+	return Layout{
+		Name:         "generic",
+		ItemPattern:  `^\s*(?P<desc>.*?[A-Za-z].*?)\s+\$?(?P<price>\d+\.\d{2})\s*[A-Z]?\s*$`,
+		TotalPattern: `(?i)^\s*(?:grand\s+)?total\b[\s:]*\$?(?P<total>\d+\.\d{2})\s*$`,
+		DatePattern:  `(?P<date>\d{4}-\d{2}-\d{2}|\d{1,2}/\d{1,2}/\d{2,4})`,
+		DateLayouts:  []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06"},
+		TimePattern:  `(?P<time>\b\d{1,2}:\d{2}(?::\d{2})?(?:\s*[AaPp][Mm])?)`,
+		TimeLayouts:  []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04 pm", "3:04pm", "3:04:05 PM"},
+		IgnorePatterns: []string{
+			`(?i)^\s*(?:sub\s*-?\s*total|tax|change|cash|visa|mastercard|amex|debit|credit|balance|tend|items? sold|thank you)\b`,
+			`^[\s*=#-]*$`,
+		},
+	}
+}
+
+// LoadLayouts reads a JSON array of Layout values from the given file.
+func LoadLayouts(path string) ([]Layout, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var layouts []Layout
+	err = json.Unmarshal(file, &layouts)
+	if err != nil {
+		return nil, fmt.Errorf("receipt layouts %s: %w", path, err)
+	}
+
+	return layouts, nil
+}
+
+// New compiles the retailer layouts. Layouts that leave a pattern or time layout empty
+// inherit it from the generic layout.
+func New(layouts []Layout) (*Parser, error) {
+	generic, err := compile(GenericLayout())
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Parser{generic: generic}
+	for _, l := range layouts {
+		if l.RetailerPattern == "" {
+			return nil, fmt.Errorf("layout %q: retailerPattern must be provided", l.Name)
+		}
+
+		g := generic.Layout
+		l.ItemPattern = orDefault(l.ItemPattern, g.ItemPattern)
+		l.TotalPattern = orDefault(l.TotalPattern, g.TotalPattern)
+		l.DatePattern = orDefault(l.DatePattern, g.DatePattern)
+		l.TimePattern = orDefault(l.TimePattern, g.TimePattern)
+		if len(l.DateLayouts) == 0 {
+			l.DateLayouts = g.DateLayouts
+		}
+		if len(l.TimeLayouts) == 0 {
+			l.TimeLayouts = g.TimeLayouts
+		}
+		if l.IgnorePatterns == nil {
+			l.IgnorePatterns = g.IgnorePatterns
+		}
+
+		compiled, err := compile(l)
+		if err != nil {
+			return nil, err
+		}
+		p.layouts = append(p.layouts, compiled)
+	}
+
+	return p, nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func compile(l Layout) (*layout, error) {
+	c := &layout{Layout: l}
+
+	var err error
+	compileRX := func(pattern string) *regexp.Regexp {
+		if pattern == "" || err != nil {
+			return nil
+		}
+		var rx *regexp.Regexp
+		rx, err = regexp.Compile(pattern)
+		if err != nil {
+			err = fmt.Errorf("layout %q: %w", l.Name, err)
+		}
+		return rx
+	}
+
+	c.retailerRX = compileRX(l.RetailerPattern)
+	c.itemRX = compileRX(l.ItemPattern)
+	c.totalRX = compileRX(l.TotalPattern)
+	c.dateRX = compileRX(l.DatePattern)
+	c.timeRX = compileRX(l.TimePattern)
+	for _, pattern := range l.IgnorePatterns {
+		c.ignoreRX = append(c.ignoreRX, compileRX(pattern))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range []struct {
+		rx   *regexp.Regexp
+		name string
+	}{{c.itemRX, "desc"}, {c.itemRX, "price"}, {c.totalRX, "total"}, {c.dateRX, "date"}, {c.timeRX, "time"}} {
+		if group.rx.SubexpIndex(group.name) < 0 {
+			return nil, fmt.Errorf("layout %q: pattern %q has no %q group", l.Name, group.rx, group.name)
+		}
+	}
+
+	return c, nil
+}
+
+func group(rx *regexp.Regexp, line, name string) (string, bool) {
+	match := rx.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(match[rx.SubexpIndex(name)]), true
+}
+
+// pick returns the first retailer layout whose pattern matches one of the header lines,
+// or the generic layout.
+func (p *Parser) pick(lines []string) *layout {
+	for _, l := range p.layouts {
+		for _, line := range lines[:min(headerLines, len(lines))] {
+			if l.retailerRX.MatchString(line) {
+				return l
+			}
+		}
+	}
+
+	return p.generic
+}
+
+// Parse turns the lines of a plain-text receipt into a data.Receipt. Fields that can't
+// be found are left empty for validation to report.
+func (p *Parser) Parse(text string) *Result {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	l := p.pick(lines)
+	receipt := &data.Receipt{Retailer: l.Retailer, Items: []data.Item{}}
+	result := &Result{Receipt: receipt, Layout: l.Name, Unparsed: []string{}}
+	hasTotal := false
+	parsed := 0
+
+lines:
+	for i, line := range lines {
+		if l.retailerRX != nil && i < headerLines && l.retailerRX.MatchString(line) {
+			parsed++
+			continue
+		}
+
+		for _, rx := range l.ignoreRX {
+			if rx.MatchString(line) {
+				parsed++
+				continue lines
+			}
+		}
+
+		if total, ok := group(l.totalRX, line, "total"); ok {
+			if d, err := decimal.NewFromString(total); err == nil {
+				receipt.Total = data.Price{Decimal: d}
+				hasTotal = true
+				parsed++
+				continue
+			}
+		}
+
+		matchedDateTime := false
+		if value, ok := group(l.dateRX, line, "date"); ok && receipt.PurchaseDate == "" {
+			if date, ok := parseTime(value, l.DateLayouts); ok {
+				receipt.PurchaseDate = date.Format("2006-01-02")
+				matchedDateTime = true
+			}
+		}
+		if value, ok := group(l.timeRX, line, "time"); ok && receipt.PurchaseTime == "" {
+			if t, ok := parseTime(value, l.TimeLayouts); ok {
+				receipt.PurchaseTime = t.Format("15:04")
+				matchedDateTime = true
+			}
+		}
+		if matchedDateTime {
+			parsed++
+			continue
+		}
+
+		if desc, ok := group(l.itemRX, line, "desc"); ok {
+			price, _ := group(l.itemRX, line, "price")
+			if d, err := decimal.NewFromString(price); err == nil {
+				receipt.Items = append(receipt.Items, data.Item{ShortDescription: desc, Price: data.Price{Decimal: d}})
+				parsed++
+				continue
+			}
+		}
+
+		// The first unrecognised line is the store header unless the layout names the
+		// retailer.
+		if receipt.Retailer == "" && len(receipt.Items) == 0 {
+			receipt.Retailer = strings.TrimSpace(line)
+			parsed++
+			continue
+		}
+
+		result.Unparsed = append(result.Unparsed, line)
+	}
+
+	result.Confidence = confidence(receipt, hasTotal, parsed, len(lines))
+	return result
+}
+
+// confidence weighs the receipt fields that were found, whether the items add up to
+// the total, and the share of lines that were understood, into a score from 0 to 1.
+func confidence(receipt *data.Receipt, hasTotal bool, parsed, lines int) float64 {
+	if lines == 0 {
+		return 0
+	}
+
+	checks := []bool{
+		receipt.Retailer != "",
+		receipt.PurchaseDate != "",
+		receipt.PurchaseTime != "",
+		hasTotal,
+		len(receipt.Items) > 0,
+	}
+
+	sum := decimal.Zero
+	for _, item := range receipt.Items {
+		sum = sum.Add(item.Price.Decimal)
+	}
+	checks = append(checks, hasTotal && len(receipt.Items) > 0 && sum.Equal(receipt.Total.Decimal))
+
+	passed := 0
+	for _, ok := range checks {
+		if ok {
+			passed++
+		}
+	}
+
+	score := 0.7*float64(passed)/float64(len(checks)) + 0.3*float64(parsed)/float64(lines)
+	return math.Round(score*100) / 100
+}
+
+func parseTime(value string, layouts []string) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}